@@ -0,0 +1,308 @@
+package celadapter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zikes/rql/adapters/internal/translate"
+	rql "github.com/zikes/rql/parse"
+)
+
+// Element is the identifier which refers to the array element itself
+// within the predicate of any or all
+const Element = "_"
+
+// Translator converts RQL nodes into CEL source text
+type Translator struct {
+	scope string // name of the comprehension variable within any/all
+	depth int    // nesting depth of any/all
+}
+
+// OperatorFunc translates a custom operator into CEL. The Translator is
+// passed so that operands may be translated with t.ToCEL.
+type OperatorFunc func(t *Translator, n *rql.OperatorNode) (string, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by ToCEL
+var DefaultTranslator = &Translator{}
+
+// ToCEL converts the node into CEL source text using the DefaultTranslator
+func ToCEL(n rql.Node) (string, error) {
+	return DefaultTranslator.ToCEL(n)
+}
+
+// comparisons maps comparison operators to CEL
+var comparisons = map[string]string{
+	"eq": "==",
+	"ne": "!=",
+	"lt": "<",
+	"gt": ">",
+	"le": "<=",
+	"ge": ">=",
+}
+
+// ToCEL converts the node into CEL source text. Dotted identifiers become
+// field selections, in becomes membership of a list, and any and all become
+// the exists and all macros. Match patterns which are only literal text
+// become contains, startsWith, endsWith or ==, and other patterns become
+// matches, with the flags written inline. The string functions lower, upper
+// and trim need the CEL strings extension, and abs the math extension.
+func (t *Translator) ToCEL(n rql.Node) (string, error) {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator == nil {
+			return "", nil
+		}
+		return t.ToCEL(n.Operator)
+	case *rql.BoolNode:
+		return fmt.Sprintf("%v", n.True), nil
+	case *rql.NullNode:
+		return "null", nil
+	case *rql.IdentifierNode:
+		return t.identifier(n), nil
+	case *rql.FunctionNode:
+		return t.function(n)
+	case *rql.StringNode:
+		return strconv.Quote(n.Text), nil
+	case *rql.NumberNode:
+		switch {
+		case strings.ContainsAny(n.Text, ".eE"):
+			// written as a float, although it may hold an integer
+		case n.IsInt:
+			return strconv.FormatInt(n.Int64, 10), nil
+		case n.IsUint:
+			return strconv.FormatUint(n.Uint64, 10) + "u", nil
+		}
+		s := strconv.FormatFloat(n.Float64, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	case *rql.ListNode:
+		str, err := t.list(n.Nodes)
+		if err != nil {
+			return "", err
+		}
+		return "[" + strings.Join(str, ", ") + "]", nil
+	case *rql.OperatorNode:
+		if n == nil || len(n.Operands.Nodes) == 0 {
+			return "", nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, n)
+		}
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge", "contains", "overlaps", "size", "any", "all":
+			if len(n.Operands.Nodes) != 2 {
+				return "", fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
+			}
+		case "in":
+			if len(n.Operands.Nodes) < 2 {
+				return "", fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
+			}
+		}
+		left, err := t.ToCEL(n.Operands.Nodes[0])
+		if err != nil {
+			return "", err
+		}
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			right, err := t.ToCEL(n.Operands.Nodes[1])
+			if err != nil {
+				return "", err
+			}
+			return left + " " + comparisons[n.Operator] + " " + right, nil
+		case "in":
+			values := n.Operands.Nodes[1:]
+			if len(values) == 1 {
+				values = elements(values[0])
+			}
+			str, err := t.list(values)
+			if err != nil {
+				return "", err
+			}
+			return left + " in [" + strings.Join(str, ", ") + "]", nil
+		case "contains", "overlaps":
+			values, err := t.list(elements(n.Operands.Nodes[1]))
+			if err != nil {
+				return "", err
+			}
+			str := []string{}
+			for _, v := range values {
+				str = append(str, v+" in "+left)
+			}
+			if n.Operator == "contains" {
+				return group(str, " && "), nil
+			}
+			return group(str, " || "), nil
+		case "size":
+			right, err := t.ToCEL(n.Operands.Nodes[1])
+			if err != nil {
+				return "", err
+			}
+			return "size(" + left + ") == " + right, nil
+		case "any", "all":
+			sub := t.scoped()
+			pred, err := sub.ToCEL(n.Operands.Nodes[1])
+			if err != nil {
+				return "", err
+			}
+			macro := "exists"
+			if n.Operator == "all" {
+				macro = "all"
+			}
+			return left + "." + macro + "(" + sub.scope + ", " + pred + ")", nil
+		case "match":
+			return t.match(n, left)
+		case "and", "or":
+			str := []string{}
+			for _, v := range n.Operands.Nodes {
+				s, err := t.ToCEL(v)
+				if err != nil {
+					return "", err
+				}
+				if op, ok := v.(*rql.OperatorNode); ok && (op.Operator == "and" || op.Operator == "or") {
+					s = "(" + s + ")"
+				}
+				str = append(str, s)
+			}
+			if n.Operator == "and" {
+				return strings.Join(str, " && "), nil
+			}
+			return strings.Join(str, " || "), nil
+		}
+		return "", fmt.Errorf("operator %s has no CEL equivalent", n.Operator)
+	}
+	return "", fmt.Errorf("unexpected node %s", n)
+}
+
+// list translates each of the nodes
+func (t *Translator) list(nodes []rql.Node) ([]string, error) {
+	str := []string{}
+	for _, v := range nodes {
+		s, err := t.ToCEL(v)
+		if err != nil {
+			return nil, err
+		}
+		str = append(str, s)
+	}
+	return str, nil
+}
+
+// elements returns the members of a list, or the node itself
+func elements(n rql.Node) []rql.Node {
+	if list, ok := n.(*rql.ListNode); ok {
+		return list.Nodes
+	}
+	return []rql.Node{n}
+}
+
+// group joins conditions, parenthesized if there is more than one
+func group(conds []string, sep string) string {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return "(" + strings.Join(conds, sep) + ")"
+}
+
+// match renders a regular expression match. Patterns consisting of literal
+// text become string functions.
+func (t *Translator) match(n *rql.OperatorNode, left string) (string, error) {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return "", err
+	}
+	if text, start, end, ok := translate.LiteralMatch(pattern, flags); ok && flags == "" {
+		switch {
+		case start && end:
+			return left + " == " + strconv.Quote(text), nil
+		case start:
+			return left + ".startsWith(" + strconv.Quote(text) + ")", nil
+		case end:
+			return left + ".endsWith(" + strconv.Quote(text) + ")", nil
+		}
+		return left + ".contains(" + strconv.Quote(text) + ")", nil
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return left + ".matches(" + strconv.Quote(pattern) + ")", nil
+}
+
+// methods maps RQL functions to CEL member functions
+var methods = map[string]string{
+	"lower":  "lowerAscii",
+	"upper":  "upperAscii",
+	"trim":   "trim",
+	"length": "size",
+	"year":   "getFullYear",
+	"day":    "getDate",
+}
+
+// function renders a scalar function call, with arithmetic functions as
+// their infix operators
+func (t *Translator) function(n *rql.FunctionNode) (string, error) {
+	args, err := t.list(n.Args.Nodes)
+	if err != nil {
+		return "", err
+	}
+	if op, ok := rql.Arithmetic[n.Name]; ok {
+		return "(" + strings.Join(args, " "+op+" ") + ")", nil
+	}
+	switch n.Name {
+	case "month":
+		// getMonth counts from zero
+		return "(" + args[0] + ".getMonth() + 1)", nil
+	case "abs":
+		return "math.abs(" + args[0] + ")", nil
+	}
+	method, ok := methods[n.Name]
+	if !ok {
+		return "", fmt.Errorf("function %s has no CEL equivalent", n.Name)
+	}
+	return args[0] + "." + method + "()", nil
+}
+
+// scoped returns a copy of the Translator which resolves identifiers
+// against the comprehension variable of exists or all
+func (t *Translator) scoped() *Translator {
+	sub := *t
+	sub.depth++
+	sub.scope = "elem"
+	if sub.depth > 1 {
+		sub.scope = fmt.Sprintf("elem%d", sub.depth)
+	}
+	return &sub
+}
+
+// identifier renders an identifier as a field selection
+func (t *Translator) identifier(n *rql.IdentifierNode) string {
+	if t.scope != "" {
+		if n.Ident == Element {
+			return t.scope
+		}
+		return t.scope + "." + n.Ident
+	}
+	return n.Ident
+}
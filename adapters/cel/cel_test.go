@@ -0,0 +1,200 @@
+package celadapter
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	memoryadapter "github.com/zikes/rql/adapters/memory"
+	rql "github.com/zikes/rql/parse"
+)
+
+type parseTest struct {
+	name   string
+	input  string
+	result string
+}
+
+var parseTests = []parseTest{
+	{"empty", "", ``},
+	{"nested", "and(eq(id,12),or(lt(age,21),gt(height,156.2)))", `id == 12 && (age < 21 || height > 156.2)`},
+
+	// operators
+	{"equals", "eq(id,12)", `id == 12`},
+	{"not equals", "ne(id,12)", `id != 12`},
+	{"less than", "lt(id,12)", `id < 12`},
+	{"greater than", "gt(id,12)", `id > 12`},
+	{"less than equals", "le(id,12)", `id <= 12`},
+	{"greater than equals", "ge(id,12)", `id >= 12`},
+	{"in", `in(name,("a","b"))`, `name in ["a", "b"]`},
+	{"in operands", `in(id,1,2,3)`, `id in [1, 2, 3]`},
+	{"in single", `in(id,1)`, `id in [1]`},
+	{"null", "eq(manager,null)", `manager == null`},
+	{"not null", "ne(manager,null)", `manager != null`},
+
+	// arrays
+	{"contains", `contains(tags,("a","b"))`, `("a" in tags && "b" in tags)`},
+	{"overlaps", `overlaps(tags,("a","b"))`, `("a" in tags || "b" in tags)`},
+	{"size", `size(tags,3)`, `size(tags) == 3`},
+	{"any element", `any(tags,eq(_,"a"))`, `tags.exists(elem, elem == "a")`},
+	{"nested any", `any(orders,all(lines,gt(qty,0)))`, `orders.exists(elem, elem.lines.all(elem2, elem2.qty > 0))`},
+
+	// match
+	{"match", `match(host,"^web[0-9]+$")`, `host.matches("^web[0-9]+$")`},
+	{"match flags", `match(host,"^web","i")`, `host.matches("(?i)^web")`},
+	{"match contains", `match(name,"J\\.R")`, `name.contains("J.R")`},
+	{"match prefix", `match(name,"^Jo")`, `name.startsWith("Jo")`},
+	{"match suffix", `match(name,"son$")`, `name.endsWith("son")`},
+	{"match exact", `match(name,"^Jo$")`, `name == "Jo"`},
+
+	// operands
+	{"path", `eq(address.city,"Oslo")`, `address.city == "Oslo"`},
+	{"function", `eq(lower(email),"x@y.com")`, `email.lowerAscii() == "x@y.com"`},
+	{"length", `gt(length(trim(name)),3)`, `name.trim().size() > 3`},
+	{"dates", `and(eq(year(born),1990),eq(month(born),5),eq(day(born),1))`, `born.getFullYear() == 1990 && (born.getMonth() + 1) == 5 && born.getDate() == 1`},
+	{"arithmetic", `gt(mul(price,1.2),100)`, `(price * 1.2) > 100`},
+	{"abs", `lt(abs(balance),10)`, `math.abs(balance) < 10`},
+	{"float", `eq(ratio,2.0)`, `ratio == 2.0`},
+	{"string", `eq(name,"a \"b\"")`, `name == "a \"b\""`},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, err := ToCEL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: CEL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+// TestEvaluate checks that CEL evaluates the translated filters to the same
+// result as the memory adapter
+func TestEvaluate(t *testing.T) {
+	records := []memoryadapter.Record{
+		{"name": "Joan", "age": int64(34), "tags": []interface{}{"a", "b"}, "address": map[string]interface{}{"city": "Oslo"}},
+		{"name": "Jack", "age": int64(19), "tags": []interface{}{"c"}, "address": map[string]interface{}{"city": "Bergen"}},
+		{"name": "mary", "age": int64(61), "tags": []interface{}{}, "address": map[string]interface{}{"city": "Oslo"}},
+	}
+	filters := []string{
+		`and(gt(age,21),match(name,"^J"))`,
+		`or(lt(age,20),eq(address.city,"Oslo"))`,
+		`in(name,("Jack","mary"))`,
+		`match(name,"^j","i")`,
+		`contains(tags,("a"))`,
+		`any(tags,eq(_,"c"))`,
+		`eq(lower(name),"mary")`,
+		`ge(sub(age,4),30)`,
+	}
+	env, err := cel.NewEnv(
+		ext.Strings(),
+		cel.Variable("name", cel.DynType),
+		cel.Variable("age", cel.DynType),
+		cel.Variable("tags", cel.DynType),
+		cel.Variable("address", cel.DynType),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filter := range filters {
+		stmt, err := rql.New(filter).Parse(filter)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		src, err := ToCEL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", filter, err)
+			continue
+		}
+		a, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Errorf("%s: %v", src, iss.Err())
+			continue
+		}
+		prg, err := env.Program(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range records {
+			want, err := memoryadapter.Match(stmt.Root, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := prg.Eval(map[string]interface{}(r))
+			if err != nil {
+				t.Errorf("%s: record %d: %v", src, i, err)
+				continue
+			}
+			if got.Value() != want {
+				t.Errorf("%s: record %d: expected %v got %v", src, i, want, got.Value())
+			}
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "near", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	stmt, err := rql.New("unsupported").Parse(`near(location,"Oslo")`)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	if got, err := ToCEL(stmt.Root); err == nil {
+		t.Errorf("expected an error, got %s", got)
+	}
+}
+
+var operandTests = []struct {
+	input string
+	err   string
+}{
+	{"eq(id)", "operator eq expects 2 operands, got 1"},
+	{"contains(x)", "operator contains expects 2 operands, got 1"},
+	{"all(true)", "operator all expects 2 operands, got 1"},
+	{"any(tags)", "operator any expects 2 operands, got 1"},
+	{"in(id)", "operator in expects at least 2 operands, got 1"},
+}
+
+func TestOperandCount(t *testing.T) {
+	for _, test := range operandTests {
+		stmt, err := rql.New(test.input).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		_, err = ToCEL(stmt.Root)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected error %q got %v", test.input, test.err, err)
+		}
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "hasRole", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	RegisterOperator("hasRole", func(t *Translator, n *rql.OperatorNode) (string, error) {
+		role, err := t.ToCEL(n.Operands.Nodes[1])
+		if err != nil {
+			return "", err
+		}
+		return role + " in roles", nil
+	})
+	stmt, err := rql.New("custom").Parse(`and(hasRole(user,"admin"),eq(id,12))`)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	want := `"admin" in roles && id == 12`
+	if got, err := ToCEL(stmt.Root); err != nil || got != want {
+		t.Errorf("CEL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s (%v)", want, got, err)
+	}
+}
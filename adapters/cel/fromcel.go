@@ -0,0 +1,478 @@
+package celadapter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	celoperators "github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/zikes/rql/adapters/internal/convert"
+	rql "github.com/zikes/rql/parse"
+)
+
+// FromCEL parses CEL source text into an RQL parse tree. The text is parsed
+// without expanding macros, so exists and all are converted into any and
+// all; see FromAST for the subset of CEL which is accepted.
+func FromCEL(name, text string) (*rql.Tree, error) {
+	if strings.TrimSpace(text) == "" {
+		return rql.New(name).Parse("")
+	}
+	env, err := cel.NewEnv(cel.ClearMacros())
+	if err != nil {
+		return nil, err
+	}
+	a, iss := env.Parse(text)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	return FromAST(name, a)
+}
+
+// FromAST converts a parsed or checked CEL expression into an RQL parse
+// tree. It accepts the comparison, logical and arithmetic operators, in
+// with a list, the exists and all macros, and the functions written by
+// ToCEL. The macros must be unexpanded, as with cel.ClearMacros, or have
+// been recorded with cel.EnableMacroCallTracking.
+//
+// RQL has no negation, so ! is applied to the conditions beneath it, and
+// conditions which cannot be negated, such as !x.contains("a"), are
+// rejected.
+func FromAST(name string, a *cel.Ast) (tree *rql.Tree, err error) {
+	native := a.NativeRep()
+	c := &converter{name: name, info: native.SourceInfo()}
+	defer convert.Recover(&err)
+	src := c.condition(c.convert(native.Expr())).String()
+	tree, err = rql.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%v in translation %s", err, src)
+	}
+	return tree, nil
+}
+
+// exprKind classifies converted expressions
+type exprKind int
+
+const (
+	exprValue     exprKind = iota // field, function call or arithmetic
+	exprLiteral                   // string, number, boolean or null
+	exprCondition                 // boolean operator
+	exprList                      // list of values
+)
+
+// expr is a converted CEL expression, held as a tree so that ! can be
+// applied to the conditions beneath it
+type expr struct {
+	kind exprKind
+	id   int64   // CEL expression id, for the position of errors
+	op   string  // RQL operator or function, empty for leaves
+	args []*expr // operands of op, or members of a list
+	text string  // RQL text of a leaf
+
+	// global size(x), which is the size operator when compared for
+	// equality and the length function otherwise
+	size bool
+}
+
+// String returns the RQL text of the expression
+func (e *expr) String() string {
+	args := []string{}
+	for _, a := range e.args {
+		args = append(args, a.String())
+	}
+	switch {
+	case e.kind == exprList:
+		return "(" + strings.Join(args, ",") + ")"
+	case e.op == "":
+		return e.text
+	}
+	return e.op + "(" + strings.Join(args, ",") + ")"
+}
+
+// str reports the text of a string literal
+func (e *expr) str() (string, bool) {
+	if e.kind != exprLiteral || !strings.HasPrefix(e.text, `"`) {
+		return "", false
+	}
+	s, err := strconv.Unquote(e.text)
+	return s, err == nil
+}
+
+// rqlComparisons maps CEL comparison operators to RQL
+var rqlComparisons = map[string]string{
+	celoperators.Equals:        "eq",
+	celoperators.NotEquals:     "ne",
+	celoperators.Less:          "lt",
+	celoperators.Greater:       "gt",
+	celoperators.LessEquals:    "le",
+	celoperators.GreaterEquals: "ge",
+}
+
+// rqlArithmetic maps CEL arithmetic operators to RQL functions
+var rqlArithmetic = map[string]string{
+	celoperators.Add:      "add",
+	celoperators.Subtract: "sub",
+	celoperators.Multiply: "mul",
+	celoperators.Divide:   "div",
+	celoperators.Modulo:   "mod",
+}
+
+// rqlMethods maps CEL member functions to RQL functions
+var rqlMethods = map[string]string{}
+
+func init() {
+	for fn, method := range methods {
+		rqlMethods[method] = fn
+	}
+}
+
+// converter converts a CEL AST into an expression tree. Errors are raised
+// by panicking with an *rql.Error, which is recovered by FromAST.
+type converter struct {
+	name string
+	info *celast.SourceInfo
+	vars []string // comprehension variables in scope, innermost last
+}
+
+// errorf raises an error at the position of the CEL expression
+func (c *converter) errorf(id int64, format string, args ...interface{}) {
+	loc := c.info.GetStartLocation(id)
+	r, _ := c.info.GetOffsetRange(id)
+	panic(&rql.Error{
+		Name:   c.name,
+		Pos:    rql.Pos(r.Start),
+		Line:   loc.Line(),
+		Column: loc.Column() + 1,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+// condition returns e as a condition, comparing a bare boolean field or
+// function with true
+func (c *converter) condition(e *expr) *expr {
+	switch e.kind {
+	case exprCondition:
+		return e
+	case exprValue:
+		return &expr{kind: exprCondition, id: e.id, op: "eq", args: []*expr{e, {kind: exprLiteral, text: "true"}}}
+	}
+	c.errorf(e.id, "expected a condition")
+	return nil
+}
+
+// value checks that e is a value rather than a condition
+func (c *converter) value(e *expr) *expr {
+	if e.kind == exprCondition || e.kind == exprList {
+		c.errorf(e.id, "expected a value")
+	}
+	return e
+}
+
+// logical joins conditions with and or or, flattening nested operators.
+// Membership tests of the same array, as written by ToCEL for contains and
+// overlaps, are joined back into one operator.
+func logical(op string, conds []*expr) *expr {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	e := &expr{kind: exprCondition, id: conds[0].id, op: op}
+	for _, c := range conds {
+		if c.op == op {
+			e.args = append(e.args, c.args...)
+		} else {
+			e.args = append(e.args, c)
+		}
+	}
+	if members := membership(e.args); members != nil {
+		array := e.args[0].args[0]
+		if op == "and" {
+			return &expr{kind: exprCondition, id: e.id, op: "contains", args: []*expr{array, members}}
+		}
+		return &expr{kind: exprCondition, id: e.id, op: "overlaps", args: []*expr{array, members}}
+	}
+	return e
+}
+
+// membership returns the values of conditions which are all single value
+// contains of the same array, or nil
+func membership(conds []*expr) *expr {
+	list := &expr{kind: exprList, id: conds[0].id}
+	for _, c := range conds {
+		if c.op != "contains" || len(c.args[1].args) != 1 || c.args[0].String() != conds[0].args[0].String() {
+			return nil
+		}
+		list.args = append(list.args, c.args[1].args[0])
+	}
+	return list
+}
+
+// convert converts a CEL expression
+func (c *converter) convert(e celast.Expr) *expr {
+	switch e.Kind() {
+	case celast.LiteralKind:
+		return c.literal(e)
+	case celast.IdentKind:
+		return c.field(e, []string{e.AsIdent()})
+	case celast.SelectKind:
+		return c.selection(e)
+	case celast.ListKind:
+		list := &expr{kind: exprList, id: e.ID()}
+		for _, v := range e.AsList().Elements() {
+			list.args = append(list.args, c.value(c.convert(v)))
+		}
+		return list
+	case celast.CallKind:
+		return c.call(e)
+	case celast.ComprehensionKind, celast.UnspecifiedExprKind:
+		// a macro expanded by the parser, or a reference to one
+		if call, ok := c.info.GetMacroCall(e.ID()); ok {
+			return c.call(call)
+		}
+		c.errorf(e.ID(), "comprehensions cannot be expressed in RQL")
+	}
+	c.errorf(e.ID(), "expression cannot be expressed in RQL")
+	return nil
+}
+
+// literal converts a constant
+func (c *converter) literal(e celast.Expr) *expr {
+	var text string
+	switch v := e.AsLiteral().(type) {
+	case types.String:
+		text = strconv.Quote(string(v))
+	case types.Int:
+		text = strconv.FormatInt(int64(v), 10)
+	case types.Uint:
+		text = strconv.FormatUint(uint64(v), 10)
+	case types.Double:
+		text = strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case types.Bool:
+		text = strconv.FormatBool(bool(v))
+	case types.Null:
+		text = "null"
+	default:
+		c.errorf(e.ID(), "%s literals cannot be expressed in RQL", v.Type())
+	}
+	return &expr{kind: exprLiteral, id: e.ID(), text: text}
+}
+
+// selection converts a chain of field selections into a dotted identifier
+func (c *converter) selection(e celast.Expr) *expr {
+	path := []string{}
+	start := e
+	for start.Kind() == celast.SelectKind {
+		sel := start.AsSelect()
+		if sel.IsTestOnly() {
+			c.errorf(e.ID(), "has() cannot be expressed in RQL")
+		}
+		path = append([]string{sel.FieldName()}, path...)
+		start = sel.Operand()
+	}
+	if start.Kind() != celast.IdentKind {
+		c.errorf(e.ID(), "selection cannot be expressed in RQL")
+	}
+	return c.field(e, append([]string{start.AsIdent()}, path...))
+}
+
+// field resolves a field path, relative to the innermost comprehension
+// variable within exists or all
+func (c *converter) field(e celast.Expr, path []string) *expr {
+	if len(c.vars) > 0 {
+		if path[0] != c.vars[len(c.vars)-1] {
+			c.errorf(e.ID(), "only fields of the variable can be used within exists or all")
+		}
+		path = path[1:]
+		if len(path) == 0 {
+			return &expr{kind: exprValue, id: e.ID(), text: Element}
+		}
+	}
+	ident := strings.Join(path, ".")
+	if !convert.ValidIdentifier(ident) {
+		c.errorf(e.ID(), "%q is not a valid RQL identifier", ident)
+	}
+	return &expr{kind: exprValue, id: e.ID(), text: ident}
+}
+
+// call converts an operator or function call
+func (c *converter) call(e celast.Expr) *expr {
+	call := e.AsCall()
+	fn, args := call.FunctionName(), call.Args()
+	if op, ok := rqlComparisons[fn]; ok {
+		left, right := c.value(c.convert(args[0])), c.value(c.convert(args[1]))
+		if op == "eq" && left.size {
+			return &expr{kind: exprCondition, id: e.ID(), op: "size", args: []*expr{left.args[0], right}}
+		}
+		if left.kind == exprLiteral && right.kind != exprLiteral {
+			left, right, op = right, left, convert.Swapped[op]
+		}
+		return &expr{kind: exprCondition, id: e.ID(), op: op, args: []*expr{left, right}}
+	}
+	if op, ok := rqlArithmetic[fn]; ok {
+		left, right := c.value(c.convert(args[0])), c.value(c.convert(args[1]))
+		if op == "add" && left.op == "getMonth" && right.text == "1" {
+			// getMonth counts from zero
+			return &expr{kind: exprValue, id: e.ID(), op: "month", args: left.args}
+		}
+		return &expr{kind: exprValue, id: e.ID(), op: op, args: []*expr{left, right}}
+	}
+	switch fn {
+	case celoperators.LogicalAnd, celoperators.LogicalOr:
+		conds := []*expr{}
+		for _, v := range args {
+			conds = append(conds, c.condition(c.convert(v)))
+		}
+		if fn == celoperators.LogicalAnd {
+			return logical("and", conds)
+		}
+		return logical("or", conds)
+	case celoperators.LogicalNot:
+		return c.negate(c.condition(c.convert(args[0])))
+	case celoperators.Negate:
+		v := c.convert(args[0])
+		if v.kind != exprLiteral || strings.HasPrefix(v.text, `"`) || strings.HasPrefix(v.text, "-") {
+			c.errorf(e.ID(), "only numbers can be negated")
+		}
+		return &expr{kind: exprLiteral, id: e.ID(), text: "-" + v.text}
+	case celoperators.In:
+		left, right := c.value(c.convert(args[0])), c.convert(args[1])
+		if right.kind == exprList {
+			return &expr{kind: exprCondition, id: e.ID(), op: "in", args: []*expr{left, right}}
+		}
+		if left.kind == exprLiteral && right.kind == exprValue {
+			// v in array
+			list := &expr{kind: exprList, id: left.id, args: []*expr{left}}
+			return &expr{kind: exprCondition, id: e.ID(), op: "contains", args: []*expr{right, list}}
+		}
+		c.errorf(e.ID(), "in cannot be expressed in RQL")
+	case "size":
+		if !call.IsMemberFunction() && len(args) == 1 {
+			v := c.value(c.convert(args[0]))
+			return &expr{kind: exprValue, id: e.ID(), op: "length", args: []*expr{v}, size: true}
+		}
+	case celoperators.Has:
+		c.errorf(e.ID(), "has() cannot be expressed in RQL")
+	case celoperators.Exists, celoperators.All:
+		return c.comprehension(e)
+	case "abs":
+		if call.IsMemberFunction() && call.Target().Kind() == celast.IdentKind && call.Target().AsIdent() == "math" {
+			return &expr{kind: exprValue, id: e.ID(), op: "abs", args: []*expr{c.value(c.convert(args[0]))}}
+		}
+	}
+	if call.IsMemberFunction() {
+		return c.method(e)
+	}
+	c.errorf(e.ID(), "function %s cannot be expressed in RQL", fn)
+	return nil
+}
+
+// method converts a member function call
+func (c *converter) method(e celast.Expr) *expr {
+	call := e.AsCall()
+	fn, args := call.FunctionName(), call.Args()
+	target := c.value(c.convert(call.Target()))
+	switch fn {
+	case "contains", "startsWith", "endsWith", "matches":
+		if len(args) != 1 {
+			break
+		}
+		text, ok := c.convert(args[0]).str()
+		if !ok {
+			c.errorf(e.ID(), "%s expects a string literal", fn)
+		}
+		pattern, flags := regexp.QuoteMeta(text), ""
+		switch fn {
+		case "startsWith":
+			pattern = "^" + pattern
+		case "endsWith":
+			pattern += "$"
+		case "matches":
+			pattern, flags = inlineFlags(text)
+		}
+		match := &expr{kind: exprCondition, id: e.ID(), op: "match", args: []*expr{target, {kind: exprLiteral, text: strconv.Quote(pattern)}}}
+		if flags != "" {
+			match.args = append(match.args, &expr{kind: exprLiteral, text: strconv.Quote(flags)})
+		}
+		return match
+	case "getMonth":
+		if len(args) == 0 {
+			// only valid within getMonth() + 1
+			return &expr{kind: exprValue, id: e.ID(), op: "getMonth", args: []*expr{target}}
+		}
+	default:
+		if name, ok := rqlMethods[fn]; ok && len(args) == 0 {
+			return &expr{kind: exprValue, id: e.ID(), op: name, args: []*expr{target}}
+		}
+	}
+	c.errorf(e.ID(), "function %s cannot be expressed in RQL", fn)
+	return nil
+}
+
+// inlineFlags splits leading RE2 flags such as (?i) from a pattern, when
+// they are all flags accepted by match
+func inlineFlags(pattern string) (string, string) {
+	if !strings.HasPrefix(pattern, "(?") {
+		return pattern, ""
+	}
+	end := strings.Index(pattern, ")")
+	if end < 0 {
+		return pattern, ""
+	}
+	flags := pattern[len("(?"):end]
+	if flags == "" || strings.Trim(flags, rql.MatchFlags) != "" {
+		return pattern, ""
+	}
+	return pattern[end+1:], flags
+}
+
+// comprehension converts the exists and all macros
+func (c *converter) comprehension(e celast.Expr) *expr {
+	call := e.AsCall()
+	args := call.Args()
+	if !call.IsMemberFunction() || len(args) != 2 || args[0].Kind() != celast.IdentKind {
+		c.errorf(e.ID(), "%s expects a variable and a predicate", call.FunctionName())
+	}
+	collection := c.value(c.convert(call.Target()))
+	c.vars = append(c.vars, args[0].AsIdent())
+	pred := c.condition(c.convert(args[1]))
+	c.vars = c.vars[:len(c.vars)-1]
+	op := "any"
+	if call.FunctionName() == celoperators.All {
+		op = "all"
+	}
+	return &expr{kind: exprCondition, id: e.ID(), op: op, args: []*expr{collection, pred}}
+}
+
+// negate returns the negation of a condition
+func (c *converter) negate(e *expr) *expr {
+	switch e.op {
+	case "and", "or":
+		conds := []*expr{}
+		for _, v := range e.args {
+			conds = append(conds, c.negate(v))
+		}
+		if e.op == "and" {
+			return logical("or", conds)
+		}
+		return logical("and", conds)
+	case "eq", "ne", "lt", "gt", "le", "ge":
+		return &expr{kind: exprCondition, id: e.id, op: convert.Negated[e.op], args: e.args}
+	case "in":
+		conds := []*expr{}
+		for _, v := range e.args[1].args {
+			conds = append(conds, &expr{kind: exprCondition, id: e.id, op: "ne", args: []*expr{e.args[0], v}})
+		}
+		return logical("and", conds)
+	case "any", "all":
+		// !x.exists(e, p) is x.all(e, !p)
+		op := "all"
+		if e.op == "all" {
+			op = "any"
+		}
+		return &expr{kind: exprCondition, id: e.id, op: op, args: []*expr{e.args[0], c.negate(e.args[1])}}
+	}
+	c.errorf(e.id, "negated %s cannot be expressed in RQL", e.op)
+	return nil
+}
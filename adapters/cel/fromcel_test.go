@@ -0,0 +1,167 @@
+package celadapter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	rql "github.com/zikes/rql/parse"
+)
+
+var fromCELTests = []struct {
+	name   string
+	input  string
+	result string
+}{
+	{"empty", "", ""},
+	{"policy", `age > 21 && name.startsWith("J")`, `and(gt(age,21),match(name,"^J"))`},
+	{"precedence", `a == 1 || b == 2 && c == 3`, `or(eq(a,1),and(eq(b,2),eq(c,3)))`},
+	{"grouping", `(a == 1 || b == 2) && c == 3`, `and(or(eq(a,1),eq(b,2)),eq(c,3))`},
+	{"flattened", `a == 1 && b == 2 && (c == 3 && d == 4)`, `and(eq(a,1),eq(b,2),eq(c,3),eq(d,4))`},
+
+	// comparisons
+	{"swapped", `21 < age`, `gt(age,21)`},
+	{"negative", `balance >= -10.5`, `ge(balance,-10.5)`},
+	{"unsigned", `id == 12u`, `eq(id,12)`},
+	{"escaped string", `name == 'O\'Brien'`, `eq(name,"O'Brien")`},
+	{"in", `name in ["a", "b"]`, `in(name,("a","b"))`},
+	{"null", `manager == null`, `eq(manager,null)`},
+	{"bare boolean", `active && !deleted`, `and(eq(active,true),ne(deleted,true))`},
+
+	// negation
+	{"not", `!(age < 21 || name == "x")`, `and(ge(age,21),ne(name,"x"))`},
+	{"not in", `!(id in [1, 2])`, `and(ne(id,1),ne(id,2))`},
+	{"not exists", `!tags.exists(t, t == "x")`, `all(tags,ne(_,"x"))`},
+
+	// arrays
+	{"member", `"a" in tags`, `contains(tags,("a"))`},
+	{"members", `"a" in tags && "b" in tags && "c" in other`, `and(contains(tags,("a","b")),contains(other,("c")))`},
+	{"any member", `"a" in tags || "b" in tags`, `overlaps(tags,("a","b"))`},
+	{"size", `size(tags) == 3`, `size(tags,3)`},
+	{"length", `size(name) > 3`, `gt(length(name),3)`},
+	{"exists", `orders.exists(o, o.total > 100)`, `any(orders,gt(total,100))`},
+	{"nested", `orders.exists(o, o.lines.all(l, l.qty > 0))`, `any(orders,all(lines,gt(qty,0)))`},
+
+	// functions
+	{"contains", `name.contains("a.b")`, `match(name,"a\\.b")`},
+	{"endsWith", `name.endsWith("son")`, `match(name,"son$")`},
+	{"matches", `name.matches("^J.*n$")`, `match(name,"^J.*n$")`},
+	{"matches flags", `name.matches("(?i)^j")`, `match(name,"^j","i")`},
+	{"scalar", `name.trim().size() > 3 && born.getFullYear() == 1990`, `and(gt(length(trim(name)),3),eq(year(born),1990))`},
+	{"month", `born.getMonth() + 1 == 5`, `eq(month(born),5)`},
+	{"abs", `math.abs(balance) < 10`, `lt(abs(balance),10)`},
+	{"arithmetic", `price * 1.2 + 5.0 > 100.0`, `gt(add(mul(price,1.2),5),100)`},
+
+	// paths
+	{"path", `address.city == "Oslo"`, `eq(address.city,"Oslo")`},
+}
+
+func TestFromCEL(t *testing.T) {
+	for _, test := range fromCELTests {
+		tree, err := FromCEL(test.name, test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := tree.Root.String(); got != test.result {
+			t.Errorf("%s: RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+var fromCELErrorTests = []struct {
+	name  string
+	input string
+	err   string
+}{
+	{"syntax", `name == "bob`, `Syntax error`},
+	{"not contains", `!name.contains("x")`, `statement: not contains:1: negated match cannot be expressed in RQL`},
+	{"function", `name.reverse() == "x"`, `statement: function:1: function reverse cannot be expressed in RQL`},
+	{"outer field", `orders.exists(o, total > 1)`, `only fields of the variable can be used within exists or all`},
+	{"not a condition", `active`, ``},
+	{"literal condition", `"x"`, `expected a condition`},
+	{"has", `has(a.b)`, `has() cannot be expressed in RQL`},
+	{"ternary", `a ? b : c`, `function _?_:_ cannot be expressed in RQL`},
+	{"map", `m == {"a": 1}`, `cannot be expressed in RQL`},
+	{"type", `name.size() == "x"`, `in translation eq(length(name),"x")`},
+	{"unterminated flags", `x.matches("(?i")`, `(?i`},
+}
+
+func TestFromCELErrors(t *testing.T) {
+	for _, test := range fromCELErrorTests {
+		_, err := FromCEL(test.name, test.input)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q got %q", test.name, test.err, err)
+		}
+	}
+}
+
+// TestMacroCalls checks that expanded macros are converted when the parser
+// has recorded their calls
+func TestMacroCalls(t *testing.T) {
+	env, err := cel.NewEnv(cel.EnableMacroCallTracking())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, iss := env.Parse(`tags.exists(t, t == "a") && orders.all(o, o.lines.exists(l, l.qty > 0))`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	tree, err := FromAST("macros", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `and(any(tags,eq(_,"a")),all(orders,any(lines,gt(qty,0))))`
+	if got := tree.Root.String(); got != want {
+		t.Errorf("RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", want, got)
+	}
+}
+
+// equivalents are the trees which come back from CEL in a different but
+// equivalent form
+var equivalents = map[string]string{
+	"match contains": `match(name,"J\\.R")`,
+	"match exact":    `eq(name,"Jo")`,
+	"float":          `eq(ratio,2)`,
+	"in operands":    `in(id,(1,2,3))`,
+	"in single":      `in(id,(1))`,
+}
+
+// TestRoundTrip checks that the CEL written by ToCEL is parsed back into
+// the same tree
+func TestRoundTrip(t *testing.T) {
+	for _, test := range parseTests {
+		input := test.input
+		if eq, ok := equivalents[test.name]; ok {
+			input = eq
+		}
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		src, err := ToCEL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		tree, err := FromCEL(test.name, src)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		want, _ := rql.Format(test.name, input)
+		if got := rql.DefaultPrinter.Format(tree); got != want {
+			t.Errorf("%s: RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s\n\tvia:\n\t\t%s", test.name, want, got, src)
+		}
+	}
+}
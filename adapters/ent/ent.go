@@ -0,0 +1,433 @@
+package entadapter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqljson"
+	"github.com/zikes/rql/adapters/internal/translate"
+	rql "github.com/zikes/rql/parse"
+)
+
+// Translator converts RQL nodes into ent predicates
+type Translator struct {
+	// Paths selects how dotted identifiers are resolved. PathJSONB and
+	// PathJSONExtract address a field within a JSON column using sqljson,
+	// which adapts to the driver's dialect.
+	Paths rql.PathStrategy
+
+	// ValidColumn reports whether a field is a column of the ent schema, and
+	// is usually the ValidColumn function of a generated package, such as
+	// user.ValidColumn. If nil, every field is accepted.
+	ValidColumn func(string) bool
+}
+
+// OperatorFunc translates a custom operator into an ent predicate. The
+// Translator and Selector are passed so that operands may be resolved with
+// t.Column.
+type OperatorFunc func(t *Translator, s *sql.Selector, n *rql.OperatorNode) *sql.Predicate
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by Predicate
+var DefaultTranslator = &Translator{}
+
+// Predicate converts the node into an ent predicate using the
+// DefaultTranslator
+func Predicate(n rql.Node) (func(*sql.Selector), error) {
+	return DefaultTranslator.Predicate(n)
+}
+
+// Predicate converts the node into an ent predicate, which may be converted
+// to the predicate type of a generated package and passed to Where:
+//
+//	p, err := entadapter.Predicate(tree.Root)
+//	users, err := client.User.Query().Where(predicate.User(p)).All(ctx)
+//
+// Fields are checked against ValidColumn, and operators which cannot be
+// translated are reported, before the predicate is returned.
+func (t *Translator) Predicate(n rql.Node) (func(*sql.Selector), error) {
+	if err := t.validate(n, false); err != nil {
+		return nil, err
+	}
+	return func(s *sql.Selector) {
+		if p := t.predicate(s, n); p != nil {
+			s.Where(p)
+		}
+	}, nil
+}
+
+// comparisons lists the operators translated as comparisons
+var comparisons = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"lt": "<",
+	"gt": ">",
+	"le": "<=",
+	"ge": ">=",
+}
+
+// validate checks the fields and operators of the node. JSON paths are only
+// allowed where path is set, as the left operand of a comparison or in with
+// values. The operands of custom operators are checked like those of match,
+// as Column resolves a JSON path to its column alone.
+func (t *Translator) validate(n rql.Node, path bool) error {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator != nil {
+			return t.validate(n.Operator, false)
+		}
+	case *rql.OperatorNode:
+		_, custom := lookupOperator(n.Operator)
+		_, comparison := comparisons[n.Operator]
+		switch {
+		case custom:
+			for _, v := range n.Operands.Nodes {
+				if err := t.validate(v, false); err != nil {
+					return err
+				}
+			}
+		case comparison, n.Operator == "in":
+			if comparison && len(n.Operands.Nodes) != 2 {
+				return fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
+			}
+			if len(n.Operands.Nodes) < 2 {
+				return fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
+			}
+			values := true
+			for _, v := range n.Operands.Nodes[1:] {
+				values = values && translate.IsLiteral(v)
+			}
+			for i, v := range n.Operands.Nodes {
+				if err := t.validate(v, i == 0 && values); err != nil {
+					return err
+				}
+			}
+		case n.Operator == "match", n.Operator == "and", n.Operator == "or":
+			for _, v := range n.Operands.Nodes {
+				if err := t.validate(v, false); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported operator %q", n.Operator)
+		}
+	case *rql.FunctionNode:
+		return t.validate(n.Args, false)
+	case *rql.ListNode:
+		for _, v := range n.Nodes {
+			if err := t.validate(v, false); err != nil {
+				return err
+			}
+		}
+	case *rql.IdentifierNode:
+		name := n.Ident
+		if t.isJSON(n) {
+			if !path {
+				return fmt.Errorf("field %q can only be compared with values", n.Ident)
+			}
+			name = n.Path()[0]
+		}
+		if t.ValidColumn != nil && !t.ValidColumn(name) {
+			return fmt.Errorf("unknown field %q", name)
+		}
+	}
+	return nil
+}
+
+// isJSON reports whether the identifier addresses a field within a JSON column
+func (t *Translator) isJSON(n *rql.IdentifierNode) bool {
+	return n.IsPath() && (t.Paths == rql.PathJSONB || t.Paths == rql.PathJSONExtract)
+}
+
+// Column returns the qualified column of the selector for an identifier
+func (t *Translator) Column(s *sql.Selector, n *rql.IdentifierNode) string {
+	if t.isJSON(n) {
+		return s.C(n.Path()[0])
+	}
+	return s.C(n.Ident)
+}
+
+// predicate converts a validated node into a predicate for the selector
+func (t *Translator) predicate(s *sql.Selector, n rql.Node) *sql.Predicate {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator == nil {
+			return nil
+		}
+		return t.predicate(s, n.Operator)
+	case *rql.OperatorNode:
+		if n == nil || len(n.Operands.Nodes) == 0 {
+			return nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, s, n)
+		}
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			return t.compare(s, n.Operator, n.Operands.Nodes[0], n.Operands.Nodes[1])
+		case "in":
+			return t.in(s, n.Operands.Nodes[0], n.Operands.Nodes[1:])
+		case "match":
+			return t.match(s, n)
+		case "or":
+			return sql.Or(t.conj(s, n.Operands.Nodes)...)
+		case "and":
+			return sql.And(t.conj(s, n.Operands.Nodes)...)
+		}
+	}
+	return nil
+}
+
+// conj translates the operands of and/or, omitting empty operators
+func (t *Translator) conj(s *sql.Selector, nodes []rql.Node) []*sql.Predicate {
+	preds := []*sql.Predicate{}
+	for _, v := range nodes {
+		if p := t.predicate(s, v); p != nil {
+			preds = append(preds, p)
+		}
+	}
+	return preds
+}
+
+// compare translates a comparison, using the predicates of the sql and
+// sqljson packages when a column is compared with a value or another column
+func (t *Translator) compare(s *sql.Selector, op string, left, right rql.Node) *sql.Predicate {
+	ident, isIdent := left.(*rql.IdentifierNode)
+	_, null := right.(*rql.NullNode)
+	switch {
+	case isIdent && t.isJSON(ident):
+		col, path := t.Column(s, ident), sqljson.Path(ident.Path()[1:]...)
+		v := translate.Value(right)
+		switch {
+		case null && op == "eq":
+			return sqljson.ValueIsNull(col, path)
+		case null && op == "ne":
+			return sql.Not(sqljson.ValueIsNull(col, path))
+		}
+		switch op {
+		case "eq":
+			return sqljson.ValueEQ(col, v, path)
+		case "ne":
+			return sqljson.ValueNEQ(col, v, path)
+		case "lt":
+			return sqljson.ValueLT(col, v, path)
+		case "gt":
+			return sqljson.ValueGT(col, v, path)
+		case "le":
+			return sqljson.ValueLTE(col, v, path)
+		case "ge":
+			return sqljson.ValueGTE(col, v, path)
+		}
+	case isIdent && null && op == "eq":
+		return sql.IsNull(t.Column(s, ident))
+	case isIdent && null && op == "ne":
+		return sql.NotNull(t.Column(s, ident))
+	case isIdent && translate.IsLiteral(right) && !null:
+		col, v := t.Column(s, ident), translate.Value(right)
+		switch op {
+		case "eq":
+			return sql.EQ(col, v)
+		case "ne":
+			return sql.NEQ(col, v)
+		case "lt":
+			return sql.LT(col, v)
+		case "gt":
+			return sql.GT(col, v)
+		case "le":
+			return sql.LTE(col, v)
+		case "ge":
+			return sql.GTE(col, v)
+		}
+	}
+	if other, ok := right.(*rql.IdentifierNode); ok && isIdent {
+		c1, c2 := t.Column(s, ident), t.Column(s, other)
+		switch op {
+		case "eq":
+			return sql.ColumnsEQ(c1, c2)
+		case "ne":
+			return sql.ColumnsNEQ(c1, c2)
+		case "lt":
+			return sql.ColumnsLT(c1, c2)
+		case "gt":
+			return sql.ColumnsGT(c1, c2)
+		case "le":
+			return sql.ColumnsLTE(c1, c2)
+		case "ge":
+			return sql.ColumnsGTE(c1, c2)
+		}
+	}
+	return sql.P(func(b *sql.Builder) {
+		t.expr(b, s, left)
+		switch {
+		case null && op == "eq":
+			b.WriteString(" IS NULL")
+		case null && op == "ne":
+			b.WriteString(" IS NOT NULL")
+		default:
+			b.WriteString(" " + comparisons[op] + " ")
+			t.expr(b, s, right)
+		}
+	})
+}
+
+// in translates in, matching any of the values
+func (t *Translator) in(s *sql.Selector, left rql.Node, operands []rql.Node) *sql.Predicate {
+	values := []interface{}{}
+	for _, v := range operands {
+		values = append(values, translate.Value(v))
+	}
+	if len(values) == 1 {
+		if list, ok := values[0].([]interface{}); ok {
+			values = list
+		}
+	}
+	if len(values) == 0 {
+		return sql.False()
+	}
+	ident, isIdent := left.(*rql.IdentifierNode)
+	switch {
+	case isIdent && t.isJSON(ident):
+		preds := []*sql.Predicate{}
+		for _, v := range values {
+			preds = append(preds, sqljson.ValueEQ(t.Column(s, ident), v, sqljson.Path(ident.Path()[1:]...)))
+		}
+		return sql.Or(preds...)
+	case isIdent:
+		return sql.In(t.Column(s, ident), values...)
+	}
+	return sql.P(func(b *sql.Builder) {
+		t.expr(b, s, left)
+		b.WriteString(" IN ")
+		b.Wrap(func(b *sql.Builder) {
+			for i, v := range values {
+				if i > 0 {
+					b.Comma()
+				}
+				b.Arg(v)
+			}
+		})
+	})
+}
+
+// match translates a regular expression match. Patterns which are only
+// anchored literal text use the portable string predicates, other patterns
+// the regular expression operator of the dialect.
+func (t *Translator) match(s *sql.Selector, n *rql.OperatorNode) *sql.Predicate {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return nil
+	}
+	left := n.Operands.Nodes[0]
+	insensitive := strings.Contains(flags, "i")
+	if ident, ok := left.(*rql.IdentifierNode); ok {
+		col := t.Column(s, ident)
+		if text, prefix, suffix, ok := translate.LiteralMatch(pattern, flags); ok {
+			switch {
+			case prefix && suffix && insensitive:
+				return sql.EqualFold(col, text)
+			case prefix && suffix:
+				return sql.EQ(col, text)
+			case !prefix && !suffix && insensitive:
+				return sql.ContainsFold(col, text)
+			case !prefix && !suffix:
+				return sql.Contains(col, text)
+			case prefix && !insensitive:
+				return sql.HasPrefix(col, text)
+			case suffix && !insensitive:
+				return sql.HasSuffix(col, text)
+			}
+		}
+	}
+	return sql.P(func(b *sql.Builder) {
+		switch b.Dialect() {
+		case dialect.MySQL:
+			b.WriteString("REGEXP_LIKE(")
+			t.expr(b, s, left)
+			b.Comma()
+			b.Arg(pattern)
+			b.Comma()
+			if insensitive {
+				b.Arg("i" + strings.Replace(flags, "i", "", -1))
+			} else {
+				b.Arg("c" + flags)
+			}
+			b.WriteString(")")
+		case dialect.SQLite:
+			t.expr(b, s, left)
+			b.WriteString(" REGEXP ")
+			if insensitive {
+				pattern = "(?i)" + pattern
+			}
+			b.Arg(pattern)
+		default:
+			t.expr(b, s, left)
+			if insensitive {
+				b.WriteString(" ~* ")
+			} else {
+				b.WriteString(" ~ ")
+			}
+			if strings.Contains(flags, "m") {
+				pattern = "(?w)" + pattern
+			}
+			b.Arg(pattern)
+		}
+	})
+}
+
+// expr writes an operand: identifiers as columns of the selector, function
+// calls as SQL functions and literals as arguments
+func (t *Translator) expr(b *sql.Builder, s *sql.Selector, n rql.Node) {
+	switch n := n.(type) {
+	case *rql.IdentifierNode:
+		b.Ident(t.Column(s, n))
+	case *rql.FunctionNode:
+		args := n.Args.Nodes
+		if op, ok := rql.Arithmetic[n.Name]; ok {
+			b.Wrap(func(b *sql.Builder) {
+				t.expr(b, s, args[0])
+				b.WriteString(" " + op + " ")
+				t.expr(b, s, args[1])
+			})
+			return
+		}
+		switch n.Name {
+		case "year", "month", "day":
+			b.WriteString("EXTRACT(" + strings.ToUpper(n.Name) + " FROM ")
+			t.expr(b, s, args[0])
+			b.WriteString(")")
+			return
+		}
+		b.WriteString(strings.ToUpper(n.Name) + "(")
+		for i, v := range args {
+			if i > 0 {
+				b.Comma()
+			}
+			t.expr(b, s, v)
+		}
+		b.WriteString(")")
+	default:
+		b.Arg(translate.Value(n))
+	}
+}
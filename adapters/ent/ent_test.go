@@ -0,0 +1,115 @@
+package entadapter
+
+import (
+	"reflect"
+	"testing"
+
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	rql "github.com/zikes/rql/parse"
+)
+
+type parseTest struct {
+	name   string
+	input  string
+	result string
+	args   []interface{}
+}
+
+var parseTests = []parseTest{
+	{"empty", "", `SELECT * FROM "users"`, nil},
+	{"nested", "and(eq(id,12),or(lt(age,21),gt(height,156.2)))", `SELECT * FROM "users" WHERE "users"."id" = $1 AND ("users"."age" < $2 OR "users"."height" > $3)`, []interface{}{int64(12), int64(21), 156.2}},
+
+	// operators
+	{"equals", "eq(id,12)", `SELECT * FROM "users" WHERE "users"."id" = $1`, []interface{}{int64(12)}},
+	{"not equals", "ne(id,12)", `SELECT * FROM "users" WHERE "users"."id" <> $1`, []interface{}{int64(12)}},
+	{"less than", "lt(id,12)", `SELECT * FROM "users" WHERE "users"."id" < $1`, []interface{}{int64(12)}},
+	{"greater than equals", "ge(id,12)", `SELECT * FROM "users" WHERE "users"."id" >= $1`, []interface{}{int64(12)}},
+	{"in", "in(id,(12,13,14))", `SELECT * FROM "users" WHERE "users"."id" IN ($1, $2, $3)`, []interface{}{int64(12), int64(13), int64(14)}},
+	{"columns", "lt(start,end)", `SELECT * FROM "users" WHERE "users"."start" < "users"."end"`, nil},
+	{"match", `match(host,"^web[0-9]")`, `SELECT * FROM "users" WHERE "users"."host" ~ $1`, []interface{}{"^web[0-9]"}},
+	{"match prefix", `match(host,"^web")`, `SELECT * FROM "users" WHERE "users"."host" LIKE $1`, []interface{}{"web%"}},
+	{"function", `eq(lower(email),"x@y.com")`, `SELECT * FROM "users" WHERE LOWER("users"."email") = $1`, []interface{}{"x@y.com"}},
+
+	{"null", "eq(id,null)", `SELECT * FROM "users" WHERE "users"."id" IS NULL`, nil},
+	{"not null", "ne(id,null)", `SELECT * FROM "users" WHERE "users"."id" IS NOT NULL`, nil},
+}
+
+// render applies the predicate to a PostgreSQL SELECT from users
+func render(p func(*sql.Selector)) (string, []interface{}) {
+	s := sql.Dialect(dialect.Postgres).Select("*").From(sql.Table("users"))
+	p(s)
+	return s.Query()
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		p, err := Predicate(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got, args := render(p)
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+		if len(args) != 0 || len(test.args) != 0 {
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("%s: expected args %v got %v", test.name, test.args, args)
+			}
+		}
+	}
+}
+
+var validationTests = []struct {
+	name  string
+	paths rql.PathStrategy
+	input string
+	err   string
+}{
+	{"known", rql.PathColumn, "and(eq(id,1),gt(lower(name),\"a\"))", ""},
+	{"unknown", rql.PathColumn, "and(eq(id,1),eq(nope,2))", `unknown field "nope"`},
+	{"unknown in function", rql.PathColumn, "eq(lower(nope),\"a\")", `unknown field "nope"`},
+	{"json column", rql.PathJSONB, "eq(meta.color,\"red\")", ""},
+	{"unknown json column", rql.PathJSONB, "eq(nope.color,\"red\")", `unknown field "nope"`},
+	{"json path in function", rql.PathJSONB, "eq(lower(meta.color),\"red\")", `field "meta.color" can only be compared with values`},
+	{"unsupported", rql.PathColumn, "size(tags,2)", `unsupported operator "size"`},
+	{"single and", rql.PathColumn, "and(eq(id,1))", ""},
+	{"single or", rql.PathColumn, "or(eq(id,1))", ""},
+	{"one operand", rql.PathColumn, "eq(id)", "operator eq expects 2 operands, got 1"},
+	{"three operands", rql.PathColumn, "lt(id,1,2)", "operator lt expects 2 operands, got 3"},
+	{"in one operand", rql.PathColumn, "in(id)", "operator in expects at least 2 operands, got 1"},
+	{"custom", rql.PathColumn, `hasRole(tags,"admin")`, ""},
+	{"unknown in custom", rql.PathColumn, `and(eq(id,1),hasRole(nope,"admin"))`, `unknown field "nope"`},
+	{"json path in custom", rql.PathJSONB, `hasRole(meta.roles,"admin")`, `field "meta.roles" can only be compared with values`},
+}
+
+func TestValidation(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "hasRole", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	RegisterOperator("hasRole", func(t *Translator, s *sql.Selector, n *rql.OperatorNode) *sql.Predicate {
+		return sql.P()
+	})
+	columns := map[string]bool{"id": true, "name": true, "meta": true, "tags": true}
+	for _, test := range validationTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		tr := &Translator{Paths: test.paths, ValidColumn: func(c string) bool { return columns[c] }}
+		_, err = tr.Predicate(stmt.Root)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.err {
+			t.Errorf("%s: expected error %q got %q", test.name, test.err, got)
+		}
+	}
+}
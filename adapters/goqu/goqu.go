@@ -1,100 +1,399 @@
 package goquadapter
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"     // register the mysql dialect
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"  // register the postgres dialect
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"   // register the sqlite3 dialect
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlserver" // register the sqlserver dialect
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/zikes/rql/adapters/internal/translate"
 	rql "github.com/zikes/rql/parse"
-	"gopkg.in/DATA-DOG/go-sqlmock.v1"
-	"gopkg.in/doug-martin/goqu.v3"
 )
 
-func ToGoqu(n rql.Node) goqu.Expression {
+// Translator converts RQL nodes into goqu expressions
+type Translator struct {
+	Paths    rql.PathStrategy // how dotted identifiers are resolved
+	Dialect  string           // goqu dialect used by ToSQL: postgres, mysql, sqlite3 or sqlserver; goqu's default if empty
+	Prepared bool             // whether ToSQL returns placeholders and arguments instead of interpolated values
+}
+
+// OperatorFunc translates a custom operator into a goqu expression. The
+// Translator is passed so that operands may be translated with t.ToGoqu.
+type OperatorFunc func(t *Translator, n *rql.OperatorNode) (exp.Expression, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by ToGoqu and ToSQL
+var DefaultTranslator = &Translator{}
+
+// column is satisfied by identifier, literal and function goqu expressions
+type column interface {
+	exp.Expression
+	exp.Comparable
+	exp.Inable
+	exp.Likeable
+}
+
+// ToGoqu converts the node into a goqu expression using the DefaultTranslator
+func ToGoqu(n rql.Node) (exp.Expression, error) {
+	return DefaultTranslator.ToGoqu(n)
+}
+
+// comparisons maps comparison operators to their goqu expressions
+var comparisons = map[string]func(c column, v interface{}) exp.Expression{
+	"eq": func(c column, v interface{}) exp.Expression { return c.Eq(v) },
+	"ne": func(c column, v interface{}) exp.Expression { return c.Neq(v) },
+	"lt": func(c column, v interface{}) exp.Expression { return c.Lt(v) },
+	"gt": func(c column, v interface{}) exp.Expression { return c.Gt(v) },
+	"le": func(c column, v interface{}) exp.Expression { return c.Lte(v) },
+	"ge": func(c column, v interface{}) exp.Expression { return c.Gte(v) },
+}
+
+// ToGoqu converts the node into a goqu expression. An empty statement
+// returns an empty goqu.Ex, and operators with no goqu translation, such as
+// the array operators, return an error rather than being left out of the
+// filter.
+func (t *Translator) ToGoqu(n rql.Node) (exp.Expression, error) {
 	switch n := n.(type) {
 	case *rql.StatementNode:
-		return ToGoqu(n.Operator)
+		if n.Operator == nil {
+			return goqu.Ex{}, nil
+		}
+		return t.ToGoqu(n.Operator)
 	case *rql.OperatorNode:
-		if n == nil || len(n.Operands.Nodes) == 0 {
-			return goqu.Ex{}
+		if n == nil {
+			return goqu.Ex{}, nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, n)
+		}
+		if len(n.Operands.Nodes) == 0 {
+			return nil, fmt.Errorf("operator %s has no operands", n.Operator)
 		}
-		left := n.Operands.Nodes[0]
-		right := n.Operands.Nodes[1]
 		switch n.Operator {
-		case "eq":
-			return goqu.I(left.(*rql.IdentifierNode).Ident).Eq(value(right))
-		case "ne":
-			return goqu.I(left.(*rql.IdentifierNode).Ident).Neq(value(right))
-		case "lt":
-			return goqu.I(left.(*rql.IdentifierNode).Ident).Lt(value(right))
-		case "gt":
-			return goqu.I(left.(*rql.IdentifierNode).Ident).Gt(value(right))
-		case "le":
-			return goqu.I(left.(*rql.IdentifierNode).Ident).Lte(value(right))
-		case "ge":
-			return goqu.I(left.(*rql.IdentifierNode).Ident).Gte(value(right))
-		case "in":
-			values := []interface{}{}
-			for _, v := range n.Operands.Nodes[1:] {
-				values = append(values, value(v))
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			if len(n.Operands.Nodes) != 2 {
+				return nil, fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
 			}
-			return goqu.I(left.(*rql.IdentifierNode).Ident).In(values)
-		case "or":
-			exOr, err := goqu.ExOr{}.ToExpressions()
+			col, err := t.column(n.Operands.Nodes[0])
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
-			for _, v := range n.Operands.Nodes {
-				exOr = exOr.Append(ToGoqu(v))
+			col = t.cast(col, n.Operands.Nodes[0], n.Operands.Nodes[1])
+			return comparisons[n.Operator](col, t.Value(n.Operands.Nodes[1])), nil
+		case "in":
+			if len(n.Operands.Nodes) < 2 {
+				return nil, fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
 			}
-			return exOr
-		case "and":
-			ex, err := goqu.Ex{}.ToExpressions()
+			col, err := t.column(n.Operands.Nodes[0])
 			if err != nil {
-				panic(err)
+				return nil, err
+			}
+			col = t.cast(col, n.Operands.Nodes[0], n.Operands.Nodes[1])
+			values := []interface{}{}
+			for _, v := range n.Operands.Nodes[1:] {
+				values = append(values, t.Value(v))
+			}
+			if len(values) == 1 {
+				if list, ok := values[0].([]interface{}); ok {
+					values = list
+				}
 			}
+			return col.In(values...), nil
+		case "match":
+			return t.match(n)
+		case "or", "and":
+			exps := []exp.Expression{}
 			for _, v := range n.Operands.Nodes {
-				ex = ex.Append(ToGoqu(v))
+				e, err := t.ToGoqu(v)
+				if err != nil {
+					return nil, err
+				}
+				exps = append(exps, e)
+			}
+			if n.Operator == "or" {
+				return goqu.Or(exps...), nil
 			}
-			return ex
+			return goqu.And(exps...), nil
 		}
+		return nil, fmt.Errorf("operator %s has no goqu translation", n.Operator)
 	}
-	return goqu.Ex{}
+	return nil, fmt.Errorf("unexpected node %s", n)
 }
 
-func ToSQL(n rql.Node) string {
-	driver, _, _ := sqlmock.New()
-	db := goqu.New("default", driver)
-	e := ToGoqu(n)
-	if reflect.DeepEqual(e, goqu.Ex{}) {
-		sql, _, _ := db.From("test").ToSql()
-		return sql
+// isEmpty reports whether the expression is the empty goqu.Ex returned for
+// empty statements
+func isEmpty(e exp.Expression) bool {
+	return reflect.DeepEqual(e, goqu.Ex{})
+}
+
+// match translates a regular expression match into the regexp operators of
+// the Translator's dialect. MySQL has no inline flag for the m flag, which is
+// passed to REGEXP_LIKE instead. SQLite's REGEXP has no case-insensitive
+// form, so the flags are given inline, as understood by the usual regexp()
+// functions, such as that of go-sqlite3.
+func (t *Translator) match(n *rql.OperatorNode) (exp.Expression, error) {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return nil, err
+	}
+	col, err := t.column(n.Operands.Nodes[0])
+	if err != nil {
+		return nil, err
 	}
-	sql, _, _ := db.From("test").Where(e).ToSql()
-	return sql
+	if t.Dialect == "sqlite3" {
+		if flags != "" {
+			pattern = "(?" + flags + ")" + pattern
+		}
+		return col.RegexpLike(pattern), nil
+	}
+	insensitive := strings.Contains(flags, "i")
+	if strings.Contains(flags, "m") {
+		if t.Dialect == "mysql" {
+			matchType := "c" + flags
+			if insensitive {
+				matchType = flags
+			}
+			return goqu.L("REGEXP_LIKE(?, ?, ?)", col, pattern, matchType), nil
+		}
+		pattern = "(?w)" + pattern
+	}
+	if insensitive {
+		return col.RegexpILike(pattern), nil
+	}
+	return col.RegexpLike(pattern), nil
 }
 
-func value(n rql.Node) interface{} {
+// column resolves an identifier according to the Translator's PathStrategy,
+// or converts a function call into a goqu function expression
+func (t *Translator) column(n rql.Node) (column, error) {
 	switch n := n.(type) {
-	case *rql.BoolNode:
-		return n.True
-	case *rql.NullNode:
-		return nil
-	case *rql.StringNode:
-		return n.Text
-	case *rql.NumberNode:
-		switch {
-		case n.IsInt:
-			return n.Int64
-		case n.IsUint:
-			return n.Uint64
-		case n.IsFloat:
-			return n.Float64
+	case *rql.FunctionNode:
+		return t.function(n), nil
+	case *rql.IdentifierNode:
+		return t.identifier(n), nil
+	}
+	return nil, fmt.Errorf("expected a field or function, got %s", n)
+}
+
+// cast casts the column of a JSONB path to the type of the value it is
+// compared with, as ->> gives text
+func (t *Translator) cast(col column, left, right rql.Node) column {
+	ident, ok := left.(*rql.IdentifierNode)
+	if !ok || !ident.IsPath() || t.Paths != rql.PathJSONB {
+		return col
+	}
+	if typ := rql.JSONBCast(right); typ != "" {
+		return goqu.L("(?)::"+typ, col)
+	}
+	return col
+}
+
+// identifier resolves an identifier according to the Translator's
+// PathStrategy
+func (t *Translator) identifier(ident *rql.IdentifierNode) column {
+	if !ident.IsPath() {
+		return goqu.I(ident.Ident)
+	}
+	path := ident.Path()
+	switch t.Paths {
+	case rql.PathJSONB:
+		sql := "?"
+		args := []interface{}{goqu.I(path[0])}
+		for i, p := range path[1:] {
+			if i == len(path)-2 {
+				sql += "->>?"
+			} else {
+				sql += "->?"
+			}
+			args = append(args, p)
 		}
-	case *rql.ListNode:
-		vals := []interface{}{}
-		for _, v := range n.Nodes {
-			vals = append(vals, value(v))
+		return goqu.L(sql, args...)
+	case rql.PathJSONExtract:
+		return goqu.L("JSON_EXTRACT(?, ?)", goqu.I(path[0]), "$."+strings.Join(path[1:], "."))
+	}
+	return goqu.I(ident.Ident)
+}
+
+// function converts a scalar function call into a goqu expression
+func (t *Translator) function(n *rql.FunctionNode) column {
+	args := []interface{}{}
+	for _, v := range n.Args.Nodes {
+		args = append(args, t.Value(v))
+	}
+	if op, ok := rql.Arithmetic[n.Name]; ok {
+		return goqu.L("(? "+op+" ?)", args...)
+	}
+	switch n.Name {
+	case "year", "month", "day":
+		return goqu.L("EXTRACT("+strings.ToUpper(n.Name)+" FROM ?)", args...)
+	}
+	return goqu.Func(strings.ToUpper(n.Name), args...)
+}
+
+// Value converts an operand into a goqu value, resolving identifiers and
+// function calls into expressions
+func (t *Translator) Value(n rql.Node) interface{} {
+	switch n := n.(type) {
+	case *rql.IdentifierNode:
+		return t.identifier(n)
+	case *rql.FunctionNode:
+		return t.function(n)
+	}
+	return translate.Value(n)
+}
+
+// ToSQL converts the node into a SELECT statement from table using the
+// DefaultTranslator
+func ToSQL(n rql.Node, table interface{}) (string, []interface{}, error) {
+	return DefaultTranslator.ToSQL(n, table)
+}
+
+// ToSQL converts the node into a SELECT statement from table, which is a
+// table name or any other expression accepted by goqu's From, in the
+// Translator's dialect. If table is a *goqu.SelectDataset the filter is added
+// to it instead, keeping its dialect. In Prepared mode values are returned as
+// arguments for the dialect's placeholders, otherwise they are interpolated
+// into the SQL.
+func (t *Translator) ToSQL(n rql.Node, table interface{}) (string, []interface{}, error) {
+	var ds *goqu.SelectDataset
+	switch table := table.(type) {
+	case *goqu.SelectDataset:
+		ds = table
+	case nil:
+		return "", nil, errors.New("no table to select from")
+	case string:
+		if table == "" {
+			return "", nil, errors.New("no table to select from")
 		}
-		return vals
+		ds = goqu.Dialect(t.Dialect).From(table)
+	default:
+		ds = goqu.Dialect(t.Dialect).From(table)
+	}
+	ds, err := t.Select(ds, n)
+	if err != nil {
+		return "", nil, err
+	}
+	return ds.ToSQL()
+}
+
+// wherePrefix is the statement ToWhere renders before the predicate
+const wherePrefix = "SELECT 1 WHERE "
+
+// ToWhere converts the node into a WHERE predicate using the
+// DefaultTranslator
+func ToWhere(n rql.Node) (string, []interface{}, error) {
+	return DefaultTranslator.ToWhere(n)
+}
+
+// ToWhere converts the node into the predicate of a WHERE clause, without the
+// WHERE keyword, in the Translator's dialect, for splicing into other
+// statements. An empty statement returns an empty predicate. In Prepared mode
+// the placeholders are numbered from the first, so the predicate should be
+// the only parameterized part of a statement in dialects with numbered
+// placeholders.
+func (t *Translator) ToWhere(n rql.Node) (string, []interface{}, error) {
+	e, err := t.ToGoqu(n)
+	if err != nil || isEmpty(e) {
+		return "", nil, err
+	}
+	sql, args, err := goqu.Dialect(t.Dialect).Select(goqu.L("1")).Prepared(t.Prepared).Where(e).ToSQL()
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.HasPrefix(sql, wherePrefix) {
+		return "", nil, fmt.Errorf("unexpected statement %q", sql)
+	}
+	return strings.TrimPrefix(sql, wherePrefix), args, nil
+}
+
+// Select adds the filter to a SELECT using the DefaultTranslator
+func Select(ds *goqu.SelectDataset, n rql.Node) (*goqu.SelectDataset, error) {
+	return DefaultTranslator.Select(ds, n)
+}
+
+// Select adds the filter to the conditions of a SELECT. The dataset keeps its
+// own dialect, and is made prepared in Prepared mode. Filters which cannot be
+// translated return an error, as for ToGoqu.
+func (t *Translator) Select(ds *goqu.SelectDataset, n rql.Node) (*goqu.SelectDataset, error) {
+	e, err := t.ToGoqu(n)
+	if err != nil {
+		return nil, err
+	}
+	if t.Prepared {
+		ds = ds.Prepared(true)
+	}
+	if !isEmpty(e) {
+		ds = ds.Where(e)
+	}
+	return ds, nil
+}
+
+// Update adds the filter to an UPDATE using the DefaultTranslator
+func Update(ds *goqu.UpdateDataset, n rql.Node) (*goqu.UpdateDataset, error) {
+	return DefaultTranslator.Update(ds, n)
+}
+
+// Update adds the filter to the conditions of an UPDATE. An empty statement
+// leaves the dataset unfiltered, updating every row, and filters which cannot
+// be translated return an error.
+func (t *Translator) Update(ds *goqu.UpdateDataset, n rql.Node) (*goqu.UpdateDataset, error) {
+	e, err := t.ToGoqu(n)
+	if err != nil {
+		return nil, err
+	}
+	if t.Prepared {
+		ds = ds.Prepared(true)
+	}
+	if !isEmpty(e) {
+		ds = ds.Where(e)
+	}
+	return ds, nil
+}
+
+// Delete adds the filter to a DELETE using the DefaultTranslator
+func Delete(ds *goqu.DeleteDataset, n rql.Node) (*goqu.DeleteDataset, error) {
+	return DefaultTranslator.Delete(ds, n)
+}
+
+// Delete adds the filter to the conditions of a DELETE. An empty statement
+// leaves the dataset unfiltered, deleting every row, and filters which cannot
+// be translated return an error.
+func (t *Translator) Delete(ds *goqu.DeleteDataset, n rql.Node) (*goqu.DeleteDataset, error) {
+	e, err := t.ToGoqu(n)
+	if err != nil {
+		return nil, err
+	}
+	if t.Prepared {
+		ds = ds.Prepared(true)
+	}
+	if !isEmpty(e) {
+		ds = ds.Where(e)
 	}
-	return nil
+	return ds, nil
 }
@@ -1,8 +1,11 @@
 package goquadapter
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	rql "github.com/zikes/rql/parse"
 )
 
@@ -25,7 +28,12 @@ var parseTests = []parseTest{
 	{"greater than equals", "ge(id,12)", `SELECT * FROM "test" WHERE ("id" >= 12)`},
 	{"and", "and(eq(id,12),lt(age,21))", `SELECT * FROM "test" WHERE (("id" = 12) AND ("age" < 21))`},
 	{"or", "or(eq(id,12),lt(age,21))", `SELECT * FROM "test" WHERE (("id" = 12) OR ("age" < 21))`},
-	{"in", "in(id,(12,13,14))", `SELECT * FROM "test" WHERE ("id" IN ((12, 13, 14)))`},
+	{"in", "in(id,(12,13,14))", `SELECT * FROM "test" WHERE ("id" IN (12, 13, 14))`},
+	{"match", `match(host,"^web")`, `SELECT * FROM "test" WHERE ("host" ~ '^web')`},
+	{"match case-insensitive", `match(host,"^web","i")`, `SELECT * FROM "test" WHERE ("host" ~* '^web')`},
+	{"function", `eq(lower(email),"x@y.com")`, `SELECT * FROM "test" WHERE (LOWER("email") = 'x@y.com')`},
+	{"extract", `eq(year(created),2024)`, `SELECT * FROM "test" WHERE (EXTRACT(YEAR FROM "created") = 2024)`},
+	{"arithmetic", `gt(mul(price,1.2),100)`, `SELECT * FROM "test" WHERE (("price" * 1.2) > 100)`},
 
 	{"null", "eq(id,null)", `SELECT * FROM "test" WHERE ("id" IS NULL)`},
 	{"bool", "eq(id,true)", `SELECT * FROM "test" WHERE ("id" IS TRUE)`},
@@ -38,9 +46,267 @@ func TestParse(t *testing.T) {
 		if err != nil {
 			t.Fatalf("unexpected parse failure: %v", err)
 		}
-		got := ToSQL(stmt.Root)
+		got, _, err := ToSQL(stmt.Root, "test")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+var pathTests = []struct {
+	name   string
+	paths  rql.PathStrategy
+	input  string
+	result string
+}{
+	{"column", rql.PathColumn, "eq(user.address.city,12)", `SELECT * FROM "test" WHERE ("user"."address"."city" = 12)`},
+	{"jsonb", rql.PathJSONB, "eq(user.address.city,12)", `SELECT * FROM "test" WHERE (("user"->'address'->>'city')::numeric = 12)`},
+	{"jsonb string", rql.PathJSONB, `eq(user.address.city,"Oslo")`, `SELECT * FROM "test" WHERE ("user"->'address'->>'city' = 'Oslo')`},
+	{"jsonb bool", rql.PathJSONB, "eq(user.active,true)", `SELECT * FROM "test" WHERE (("user"->>'active')::boolean IS TRUE)`},
+	{"jsonb in", rql.PathJSONB, "in(user.age,(21,30))", `SELECT * FROM "test" WHERE (("user"->>'age')::numeric IN (21, 30))`},
+	{"json_extract", rql.PathJSONExtract, "eq(user.address.city,12)", `SELECT * FROM "test" WHERE (JSON_EXTRACT("user", '$.address.city') = 12)`},
+	{"not a path", rql.PathJSONB, "eq(city,12)", `SELECT * FROM "test" WHERE ("city" = 12)`},
+}
+
+func TestPaths(t *testing.T) {
+	for _, test := range pathTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, _, err := (&Translator{Paths: test.paths}).ToSQL(stmt.Root, "test")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "hasRole", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	RegisterOperator("hasRole", func(t *Translator, n *rql.OperatorNode) (exp.Expression, error) {
+		return goqu.L("? = ANY(?)", t.Value(n.Operands.Nodes[1]), t.Value(n.Operands.Nodes[0])), nil
+	})
+	stmt, err := rql.New("custom").Parse(`hasRole(roles,"admin")`)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	want := `SELECT * FROM "test" WHERE 'admin' = ANY("roles")`
+	if got, _, _ := ToSQL(stmt.Root, "test"); got != want {
+		t.Errorf("SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", want, got)
+	}
+}
+
+var dialectTests = []struct {
+	name     string
+	dialect  string
+	prepared bool
+	input    string
+	result   string
+	args     []interface{}
+}{
+	{"postgres", "postgres", false, `and(eq(id,12),match(host,"^web"))`, `SELECT * FROM "test" WHERE (("id" = 12) AND ("host" ~ '^web'))`, nil},
+	{"postgres prepared", "postgres", true, `and(eq(id,12),match(host,"^web"))`, `SELECT * FROM "test" WHERE (("id" = $1) AND ("host" ~ $2))`, []interface{}{int64(12), "^web"}},
+	{"mysql", "mysql", false, `and(eq(id,12),match(host,"^web"))`, "SELECT * FROM `test` WHERE ((`id` = 12) AND (`host` REGEXP BINARY '^web'))", nil},
+	{"mysql prepared", "mysql", true, `in(id,(1,2))`, "SELECT * FROM `test` WHERE (`id` IN (?, ?))", []interface{}{int64(1), int64(2)}},
+	{"mysql multiline", "mysql", false, `match(host,"^web","im")`, "SELECT * FROM `test` WHERE REGEXP_LIKE(`host`, '^web', 'im')", nil},
+	{"sqlite3", "sqlite3", false, `match(host,"^web","i")`, "SELECT * FROM `test` WHERE (`host` REGEXP '(?i)^web')", nil},
+	{"sqlite3 multiline", "sqlite3", false, `match(host,"^web","m")`, "SELECT * FROM `test` WHERE (`host` REGEXP '(?m)^web')", nil},
+	{"sqlserver prepared", "sqlserver", true, `eq(id,12)`, `SELECT * FROM "test" WHERE ("id" = @p1)`, []interface{}{int64(12)}},
+}
+
+func TestDialects(t *testing.T) {
+	for _, test := range dialectTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		tr := &Translator{Dialect: test.dialect, Prepared: test.prepared}
+		got, args, err := tr.ToSQL(stmt.Root, "test")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+		if len(args) != 0 || len(test.args) != 0 {
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("%s: expected args %v got %v", test.name, test.args, args)
+			}
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	stmt, err := rql.New("bool").Parse(`eq(active,true)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := (&Translator{Dialect: "sqlserver"}).ToSQL(stmt.Root, "test"); err == nil {
+		t.Errorf("expected an error for booleans in sqlserver")
+	}
+}
+
+func TestUntranslatable(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "near", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	d := goqu.Dialect("postgres")
+	for _, input := range []string{
+		`size(tags,2)`,
+		`contains(tags,("x"))`,
+		`overlaps(tags,("x"))`,
+		`any(tags,eq(_,"x"))`,
+		`all(tags,eq(_,"x"))`,
+		`near(location,"Oslo")`,
+		`and(eq(tenant,1),contains(tags,("x")))`,
+		`eq(id)`,
+		`eq(id,1,2)`,
+		`in(id)`,
+	} {
+		stmt, err := rql.New(input).Parse(input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		if e, err := ToGoqu(stmt.Root); err == nil {
+			t.Errorf("%s: expected an error, got %v", input, e)
+		}
+		if sql, _, err := ToWhere(stmt.Root); err == nil {
+			t.Errorf("%s: expected an error, got %s", input, sql)
+		}
+		if _, err := Select(d.From("t"), stmt.Root); err == nil {
+			t.Errorf("%s: expected an error from Select", input)
+		}
+		if _, err := Update(d.Update("t").Set(goqu.Record{"a": 1}), stmt.Root); err == nil {
+			t.Errorf("%s: expected an error from Update", input)
+		}
+		if _, err := Delete(d.Delete("t"), stmt.Root); err == nil {
+			t.Errorf("%s: expected an error from Delete", input)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	stmt, err := rql.New("tables").Parse(`eq(id,12)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		table  interface{}
+		result string
+	}{
+		{"name", "users", `SELECT * FROM "users" WHERE ("id" = 12)`},
+		{"qualified", goqu.T("users").Schema("auth"), `SELECT * FROM "auth"."users" WHERE ("id" = 12)`},
+		{"dataset", goqu.Dialect("mysql").From("users").Select("id").Where(goqu.I("active").IsTrue()), "SELECT `id` FROM `users` WHERE ((`active` IS TRUE) AND (`id` = 12))"},
+	}
+	for _, test := range tests {
+		got, _, err := ToSQL(stmt.Root, test.table)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+	for _, table := range []interface{}{nil, ""} {
+		if _, _, err := ToSQL(stmt.Root, table); err == nil {
+			t.Errorf("expected an error for table %#v", table)
+		}
+	}
+}
+
+var whereTests = []struct {
+	name     string
+	dialect  string
+	prepared bool
+	input    string
+	result   string
+	args     []interface{}
+}{
+	{"empty", "", false, "", "", nil},
+	{"default", "", false, "and(eq(id,12),lt(age,21))", `(("id" = 12) AND ("age" < 21))`, nil},
+	{"mysql", "mysql", false, `eq(name,"bob")`, "(`name` = 'bob')", nil},
+	{"prepared", "postgres", true, "and(eq(id,12),in(age,(1,2)))", `(("id" = $1) AND ("age" IN ($2, $3)))`, []interface{}{int64(12), int64(1), int64(2)}},
+}
+
+func TestWhere(t *testing.T) {
+	for _, test := range whereTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		tr := &Translator{Dialect: test.dialect, Prepared: test.prepared}
+		got, args, err := tr.ToWhere(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+		if len(args) != 0 || len(test.args) != 0 {
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("%s: expected args %v got %v", test.name, test.args, args)
+			}
+		}
+	}
+}
+
+func TestDatasets(t *testing.T) {
+	stmt, err := rql.New("datasets").Parse(`eq(id,12)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type dataset interface {
+		ToSQL() (string, []interface{}, error)
+	}
+	tr := &Translator{Prepared: true}
+	d := goqu.Dialect("postgres")
+	tests := []struct {
+		name   string
+		ds     func() (dataset, error)
+		result string
+		args   []interface{}
+	}{
+		{"select", func() (dataset, error) { return tr.Select(d.From("users").Select("name"), stmt.Root) }, `SELECT "name" FROM "users" WHERE ("id" = $1)`, []interface{}{int64(12)}},
+		{"update", func() (dataset, error) {
+			return tr.Update(d.Update("users").Set(goqu.Record{"name": "bob"}), stmt.Root)
+		}, `UPDATE "users" SET "name"=$1 WHERE ("id" = $2)`, []interface{}{"bob", int64(12)}},
+		{"delete", func() (dataset, error) { return tr.Delete(d.Delete("users"), stmt.Root) }, `DELETE FROM "users" WHERE ("id" = $1)`, []interface{}{int64(12)}},
+		{"unprepared", func() (dataset, error) { return Delete(d.Delete("users"), stmt.Root) }, `DELETE FROM "users" WHERE ("id" = 12)`, nil},
+	}
+	for _, test := range tests {
+		ds, err := test.ds()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got, args, err := ds.ToSQL()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
 		if got != test.result {
 			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
 		}
+		if len(args) != 0 || len(test.args) != 0 {
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("%s: expected args %v got %v", test.name, test.args, args)
+			}
+		}
 	}
 }
@@ -0,0 +1,287 @@
+package gormadapter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/zikes/rql/adapters/internal/translate"
+	rql "github.com/zikes/rql/parse"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Translator converts RQL nodes into GORM clause expressions
+type Translator struct {
+	Paths rql.PathStrategy // how dotted identifiers are resolved
+}
+
+// OperatorFunc translates a custom operator into a clause expression. The
+// Translator is passed so that operands may be translated with t.ToClause
+// and t.Operand.
+type OperatorFunc func(t *Translator, n *rql.OperatorNode) (clause.Expression, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by Scope and ToClause
+var DefaultTranslator = &Translator{}
+
+// Scope converts the node into a GORM scope using the DefaultTranslator
+func Scope(n rql.Node) func(*gorm.DB) *gorm.DB {
+	return DefaultTranslator.Scope(n)
+}
+
+// Scope converts the node into a GORM scope, for use with db.Scopes, which
+// adds the filter to the query as a parameterized Where condition. RQL has
+// no sorting or paging, so Order and Limit are left to the caller. If the
+// node cannot be translated, the scope adds the error to the query with
+// db.AddError, so that it is not run unfiltered.
+func (t *Translator) Scope(n rql.Node) func(*gorm.DB) *gorm.DB {
+	e, err := t.ToClause(n)
+	return func(db *gorm.DB) *gorm.DB {
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		if e == nil {
+			return db
+		}
+		return db.Where(e)
+	}
+}
+
+// ToClause converts the node into a clause expression using the
+// DefaultTranslator
+func ToClause(n rql.Node) (clause.Expression, error) {
+	return DefaultTranslator.ToClause(n)
+}
+
+// ToClause converts the node into a clause expression, or nil for an empty
+// statement. Operators with no GORM translation, such as the array
+// operators, return an error rather than being left out of the filter.
+func (t *Translator) ToClause(n rql.Node) (clause.Expression, error) {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator == nil {
+			return nil, nil
+		}
+		return t.ToClause(n.Operator)
+	case *rql.OperatorNode:
+		if n == nil {
+			return nil, nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, n)
+		}
+		if len(n.Operands.Nodes) == 0 {
+			return nil, fmt.Errorf("operator %s has no operands", n.Operator)
+		}
+		left := n.Operands.Nodes[0]
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			if len(n.Operands.Nodes) != 2 {
+				return nil, fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
+			}
+			return t.compare(n.Operator, left, n.Operands.Nodes[1]), nil
+		case "in":
+			if len(n.Operands.Nodes) < 2 {
+				return nil, fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
+			}
+			values := []interface{}{}
+			for _, v := range n.Operands.Nodes[1:] {
+				values = append(values, translate.Value(v))
+			}
+			if len(values) == 1 {
+				if list, ok := values[0].([]interface{}); ok {
+					values = list
+				}
+			}
+			col := t.cast(t.Operand(left), left, n.Operands.Nodes[1])
+			if _, ok := col.(clause.Column); ok {
+				return clause.IN{Column: col, Values: values}, nil
+			}
+			return clause.Expr{SQL: "? IN ?", Vars: []interface{}{col, values}}, nil
+		case "match":
+			return t.match(n)
+		case "or", "and":
+			exprs := []clause.Expression{}
+			for _, v := range n.Operands.Nodes {
+				e, err := t.ToClause(v)
+				if err != nil {
+					return nil, err
+				}
+				exprs = append(exprs, e)
+			}
+			if n.Operator == "and" {
+				return clause.And(exprs...), nil
+			}
+			if len(exprs) == 1 {
+				return exprs[0], nil
+			}
+			return clause.Or(exprs...), nil
+		}
+		return nil, fmt.Errorf("operator %s has no GORM translation", n.Operator)
+	}
+	return nil, fmt.Errorf("unexpected node %s", n)
+}
+
+// comparisons maps comparison operators to SQL
+var comparisons = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"lt": "<",
+	"gt": ">",
+	"le": "<=",
+	"ge": ">=",
+}
+
+// compare translates a comparison. Columns compared with literals use the
+// clause types, which turn null into IS NULL and IS NOT NULL.
+func (t *Translator) compare(op string, left, right rql.Node) clause.Expression {
+	col := t.cast(t.Operand(left), left, right)
+	if c, ok := col.(clause.Column); ok && translate.IsLiteral(right) {
+		v := translate.Value(right)
+		switch op {
+		case "eq":
+			return clause.Eq{Column: c, Value: v}
+		case "ne":
+			return clause.Neq{Column: c, Value: v}
+		case "lt":
+			return clause.Lt{Column: c, Value: v}
+		case "gt":
+			return clause.Gt{Column: c, Value: v}
+		case "le":
+			return clause.Lte{Column: c, Value: v}
+		case "ge":
+			return clause.Gte{Column: c, Value: v}
+		}
+	}
+	if _, ok := right.(*rql.NullNode); ok {
+		switch op {
+		case "eq":
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{col}}
+		case "ne":
+			return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{col}}
+		}
+	}
+	return clause.Expr{SQL: "? " + comparisons[op] + " ?", Vars: []interface{}{col, t.Operand(right)}}
+}
+
+// match translates a regular expression match for PostgreSQL. Patterns
+// which are only anchored literal text become LIKE, or ILIKE with the i
+// flag, and other patterns use the ~ and ~* operators. ILIKE, ~ and ~* are
+// specific to PostgreSQL, so other databases can only match case-sensitive
+// literal patterns.
+func (t *Translator) match(n *rql.OperatorNode) (clause.Expression, error) {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return nil, err
+	}
+	col := t.Operand(n.Operands.Nodes[0])
+	insensitive := strings.Contains(flags, "i")
+	if like, ok := translate.LikePattern(pattern, flags); ok {
+		if c, ok := col.(clause.Column); ok && !insensitive {
+			return clause.Like{Column: c, Value: like}, nil
+		}
+		op := "LIKE"
+		if insensitive {
+			op = "ILIKE"
+		}
+		return clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{col, like}}, nil
+	}
+	op := "~"
+	if insensitive {
+		op = "~*"
+	}
+	if strings.Contains(flags, "m") {
+		pattern = "(?w)" + pattern
+	}
+	return clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{col, pattern}}, nil
+}
+
+// Operand converts an operand into a clause variable: a clause.Column for
+// identifiers, a clause.Expr for JSON paths and function calls, and the Go
+// value of literals.
+func (t *Translator) Operand(n rql.Node) interface{} {
+	switch n := n.(type) {
+	case *rql.IdentifierNode:
+		return t.column(n)
+	case *rql.FunctionNode:
+		return t.function(n)
+	}
+	return translate.Value(n)
+}
+
+// cast casts the operand of a JSONB path to the type of the value it is
+// compared with, as ->> gives text
+func (t *Translator) cast(col interface{}, left, right rql.Node) interface{} {
+	ident, ok := left.(*rql.IdentifierNode)
+	if !ok || !ident.IsPath() || t.Paths != rql.PathJSONB {
+		return col
+	}
+	if typ := rql.JSONBCast(right); typ != "" {
+		return clause.Expr{SQL: "(?)::" + typ, Vars: []interface{}{col}}
+	}
+	return col
+}
+
+// column resolves an identifier according to the Translator's PathStrategy
+func (t *Translator) column(ident *rql.IdentifierNode) interface{} {
+	if !ident.IsPath() {
+		return clause.Column{Name: ident.Ident}
+	}
+	path := ident.Path()
+	switch t.Paths {
+	case rql.PathJSONB:
+		sql := "?"
+		vars := []interface{}{clause.Column{Name: path[0]}}
+		for i, p := range path[1:] {
+			if i == len(path)-2 {
+				sql += "->>?"
+			} else {
+				sql += "->?"
+			}
+			vars = append(vars, p)
+		}
+		return clause.Expr{SQL: sql, Vars: vars}
+	case rql.PathJSONExtract:
+		return clause.Expr{SQL: "JSON_EXTRACT(?, ?)", Vars: []interface{}{clause.Column{Name: path[0]}, "$." + strings.Join(path[1:], ".")}}
+	}
+	return clause.Column{Name: ident.Ident}
+}
+
+// function converts a scalar function call into a clause expression
+func (t *Translator) function(n *rql.FunctionNode) clause.Expr {
+	vars := []interface{}{}
+	placeholders := []string{}
+	for _, v := range n.Args.Nodes {
+		vars = append(vars, t.Operand(v))
+		placeholders = append(placeholders, "?")
+	}
+	if op, ok := rql.Arithmetic[n.Name]; ok {
+		return clause.Expr{SQL: "(" + strings.Join(placeholders, " "+op+" ") + ")", Vars: vars}
+	}
+	switch n.Name {
+	case "year", "month", "day":
+		return clause.Expr{SQL: "EXTRACT(" + strings.ToUpper(n.Name) + " FROM ?)", Vars: vars}
+	}
+	return clause.Expr{SQL: strings.ToUpper(n.Name) + "(" + strings.Join(placeholders, ", ") + ")", Vars: vars}
+}
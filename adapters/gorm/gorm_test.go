@@ -0,0 +1,176 @@
+package gormadapter
+
+import (
+	"reflect"
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/utils/tests"
+)
+
+type parseTest struct {
+	name   string
+	input  string
+	result string
+	vars   []interface{}
+}
+
+var parseTests = []parseTest{
+	{"empty", "", "SELECT * FROM `test`", nil},
+	{"nested", "and(eq(id,12),or(lt(age,21),gt(height,156.2)))", "SELECT * FROM `test` WHERE `id` = ? AND (`age` < ? OR `height` > ?)", []interface{}{int64(12), int64(21), 156.2}},
+
+	// operators
+	{"equals", "eq(id,12)", "SELECT * FROM `test` WHERE `id` = ?", []interface{}{int64(12)}},
+	{"not equals", "ne(id,12)", "SELECT * FROM `test` WHERE `id` <> ?", []interface{}{int64(12)}},
+	{"less than", "lt(id,12)", "SELECT * FROM `test` WHERE `id` < ?", []interface{}{int64(12)}},
+	{"greater than", "gt(id,12)", "SELECT * FROM `test` WHERE `id` > ?", []interface{}{int64(12)}},
+	{"less than equals", "le(id,12)", "SELECT * FROM `test` WHERE `id` <= ?", []interface{}{int64(12)}},
+	{"greater than equals", "ge(id,12)", "SELECT * FROM `test` WHERE `id` >= ?", []interface{}{int64(12)}},
+	{"and", "and(eq(id,12),lt(age,21))", "SELECT * FROM `test` WHERE `id` = ? AND `age` < ?", []interface{}{int64(12), int64(21)}},
+	{"or", "or(eq(id,12),lt(age,21))", "SELECT * FROM `test` WHERE (`id` = ? OR `age` < ?)", []interface{}{int64(12), int64(21)}},
+	{"in", "in(id,(12,13,14))", "SELECT * FROM `test` WHERE `id` IN (?,?,?)", []interface{}{int64(12), int64(13), int64(14)}},
+	{"columns", "lt(start,end)", "SELECT * FROM `test` WHERE `start` < `end`", nil},
+	{"match", `match(host,"^web[0-9]")`, "SELECT * FROM `test` WHERE `host` ~ ?", []interface{}{"^web[0-9]"}},
+	{"match case-insensitive", `match(host,"^web[0-9]","i")`, "SELECT * FROM `test` WHERE `host` ~* ?", []interface{}{"^web[0-9]"}},
+	{"match prefix", `match(host,"^web")`, "SELECT * FROM `test` WHERE `host` LIKE ?", []interface{}{"web%"}},
+	{"match contains", `match(name,"50_off","i")`, "SELECT * FROM `test` WHERE `name` ILIKE ?", []interface{}{`%50\_off%`}},
+	{"function", `eq(lower(email),"x@y.com")`, "SELECT * FROM `test` WHERE LOWER(`email`) = ?", []interface{}{"x@y.com"}},
+	{"extract", `eq(year(created),2024)`, "SELECT * FROM `test` WHERE EXTRACT(YEAR FROM `created`) = ?", []interface{}{int64(2024)}},
+	{"arithmetic", `gt(mul(price,1.2),100)`, "SELECT * FROM `test` WHERE (`price` * ?) > ?", []interface{}{1.2, int64(100)}},
+	{"function in", `in(lower(name),("a","b"))`, "SELECT * FROM `test` WHERE LOWER(`name`) IN (?,?)", []interface{}{"a", "b"}},
+
+	{"null", "eq(id,null)", "SELECT * FROM `test` WHERE `id` IS NULL", nil},
+	{"not null", "ne(id,null)", "SELECT * FROM `test` WHERE `id` IS NOT NULL", nil},
+	{"function null", "eq(lower(name),null)", "SELECT * FROM `test` WHERE LOWER(`name`) IS NULL", nil},
+	{"bool", "eq(id,true)", "SELECT * FROM `test` WHERE `id` = ?", []interface{}{true}},
+	{"string", `eq(id,"test")`, "SELECT * FROM `test` WHERE `id` = ?", []interface{}{"test"}},
+}
+
+// dryRun returns the SQL and variables of a SELECT from test with the scope
+func dryRun(t *testing.T, scope func(*gorm.DB) *gorm.DB) (string, []interface{}) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []map[string]interface{}{}
+	stmt := db.Table("test").Scopes(scope).Find(&rows).Statement
+	return stmt.SQL.String(), stmt.Vars
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, vars := dryRun(t, Scope(stmt.Root))
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+		if len(vars) != 0 || len(test.vars) != 0 {
+			if !reflect.DeepEqual(vars, test.vars) {
+				t.Errorf("%s: expected vars %v got %v", test.name, test.vars, vars)
+			}
+		}
+	}
+}
+
+var pathTests = []struct {
+	name   string
+	paths  rql.PathStrategy
+	input  string
+	result string
+}{
+	{"column", rql.PathColumn, "eq(user.address.city,12)", "SELECT * FROM `test` WHERE `user`.`address`.`city` = ?"},
+	{"jsonb", rql.PathJSONB, "eq(user.address.city,12)", "SELECT * FROM `test` WHERE (`user`->?->>?)::numeric = ?"},
+	{"jsonb string", rql.PathJSONB, `eq(user.address.city,"Oslo")`, "SELECT * FROM `test` WHERE `user`->?->>? = ?"},
+	{"jsonb bool", rql.PathJSONB, "eq(user.active,true)", "SELECT * FROM `test` WHERE (`user`->>?)::boolean = ?"},
+	{"jsonb in", rql.PathJSONB, "in(user.age,(21,30))", "SELECT * FROM `test` WHERE (`user`->>?)::numeric IN (?,?)"},
+	{"json_extract", rql.PathJSONExtract, "eq(user.address.city,12)", "SELECT * FROM `test` WHERE JSON_EXTRACT(`user`, ?) = ?"},
+	{"not a path", rql.PathJSONB, "eq(city,12)", "SELECT * FROM `test` WHERE `city` = ?"},
+}
+
+func TestPaths(t *testing.T) {
+	for _, test := range pathTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, _ := dryRun(t, (&Translator{Paths: test.paths}).Scope(stmt.Root))
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "hasRole", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterOperator("hasRole", func(t *Translator, n *rql.OperatorNode) (clause.Expression, error) {
+		return clause.Expr{SQL: "? = ANY(?)", Vars: []interface{}{t.Operand(n.Operands.Nodes[1]), t.Operand(n.Operands.Nodes[0])}}, nil
+	})
+	stmt, err := rql.New("custom").Parse(`and(hasRole(roles,"admin"),eq(id,1))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := dryRun(t, Scope(stmt.Root))
+	if expected := "SELECT * FROM `test` WHERE ? = ANY(`roles`) AND `id` = ?"; got != expected {
+		t.Errorf("expected %s got %s", expected, got)
+	}
+}
+
+func TestUntranslatable(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "near", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{
+		`size(tags,2)`,
+		`contains(tags,("x"))`,
+		`any(tags,eq(_,"x"))`,
+		`near(location,"Oslo")`,
+		`and(eq(tenant,1),contains(tags,("x")))`,
+	} {
+		stmt, err := rql.New(input).Parse(input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		if e, err := ToClause(stmt.Root); err == nil {
+			t.Errorf("%s: expected an error, got %v", input, e)
+		}
+		rows := []map[string]interface{}{}
+		if err := db.Table("test").Scopes(Scope(stmt.Root)).Find(&rows).Error; err == nil {
+			t.Errorf("%s: expected the scope to add an error", input)
+		}
+	}
+}
+
+var operandTests = []struct {
+	input string
+	err   string
+}{
+	{"eq(id)", "operator eq expects 2 operands, got 1"},
+	{"eq(id,1,2)", "operator eq expects 2 operands, got 3"},
+	{"in(id)", "operator in expects at least 2 operands, got 1"},
+}
+
+func TestOperandCount(t *testing.T) {
+	for _, test := range operandTests {
+		stmt, err := rql.New(test.input).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		_, err = ToClause(stmt.Root)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected error %q got %v", test.input, test.err, err)
+		}
+	}
+}
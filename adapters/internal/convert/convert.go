@@ -0,0 +1,65 @@
+// Package convert holds the helpers shared by the adapters which convert
+// other filter languages into RQL. Converters raise their errors by
+// panicking with an *rql.Error, built by ErrorAt and recovered by Recover.
+package convert
+
+import (
+	"regexp"
+	"strings"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+// Negated maps comparison operators to their negation
+var Negated = map[string]string{
+	"eq": "ne",
+	"ne": "eq",
+	"lt": "ge",
+	"ge": "lt",
+	"gt": "le",
+	"le": "gt",
+}
+
+// Swapped maps comparison operators to the operator which is equivalent
+// once their operands are swapped
+var Swapped = map[string]string{
+	"eq": "eq",
+	"ne": "ne",
+	"lt": "gt",
+	"gt": "lt",
+	"le": "ge",
+	"ge": "le",
+}
+
+// validIdentifier matches the identifiers RQL can express
+var validIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// ValidIdentifier reports whether ident, a field name or a dotted path, can
+// be written as an RQL identifier
+func ValidIdentifier(ident string) bool {
+	return validIdentifier.MatchString(ident)
+}
+
+// ErrorAt returns an error at the byte offset pos of the named text
+func ErrorAt(name, text string, pos int, msg string) *rql.Error {
+	before := text[:pos]
+	return &rql.Error{
+		Name:   name,
+		Pos:    rql.Pos(pos),
+		Line:   1 + strings.Count(before, "\n"),
+		Column: pos - strings.LastIndex(before, "\n"),
+		Msg:    msg,
+	}
+}
+
+// Recover turns an error raised by a converter into a return value. It must
+// be deferred directly; other panics are not recovered.
+func Recover(errp *error) {
+	if e := recover(); e != nil {
+		err, ok := e.(*rql.Error)
+		if !ok {
+			panic(e)
+		}
+		*errp = err
+	}
+}
@@ -0,0 +1,99 @@
+// Package translate holds the helpers shared by the adapters which translate
+// RQL trees into queries.
+package translate
+
+import (
+	"regexp/syntax"
+	"strings"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+// IsLiteral reports whether the node is a value, rather than a field or a
+// function call
+func IsLiteral(n rql.Node) bool {
+	switch n.(type) {
+	case *rql.IdentifierNode, *rql.FunctionNode:
+		return false
+	}
+	return true
+}
+
+// Value returns the Go value of a literal: a bool, nil, string, int64,
+// uint64 or float64, or a []interface{} of them for a list. Other nodes
+// give nil.
+func Value(n rql.Node) interface{} {
+	switch n := n.(type) {
+	case *rql.BoolNode:
+		return n.True
+	case *rql.NullNode:
+		return nil
+	case *rql.StringNode:
+		return n.Text
+	case *rql.NumberNode:
+		switch {
+		case n.IsInt:
+			return n.Int64
+		case n.IsUint:
+			return n.Uint64
+		case n.IsFloat:
+			return n.Float64
+		}
+	case *rql.ListNode:
+		vals := []interface{}{}
+		for _, v := range n.Nodes {
+			vals = append(vals, Value(v))
+		}
+		return vals
+	}
+	return nil
+}
+
+// LiteralMatch reports the text matched by a pattern consisting of literal
+// text, optionally anchored with ^ and $, and which anchors it has. It
+// reports false for other patterns, and for the m flag; the i flag is left to
+// the caller.
+func LiteralMatch(pattern, flags string) (text string, start, end, ok bool) {
+	if strings.Contains(flags, "m") {
+		return "", false, false, false
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false, false, false
+	}
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	if len(subs) > 0 && subs[0].Op == syntax.OpBeginText {
+		subs, start = subs[1:], true
+	}
+	if len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText {
+		subs, end = subs[:len(subs)-1], true
+	}
+	if len(subs) != 1 || subs[0].Op != syntax.OpLiteral {
+		return "", false, false, false
+	}
+	return string(subs[0].Rune), start, end, true
+}
+
+// likeEscaper escapes the LIKE wildcards in literal text
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikePattern converts a pattern accepted by LiteralMatch into the equivalent
+// SQL LIKE pattern, with backslash as the escape character. It reports false
+// for other patterns; the i flag is left to the caller.
+func LikePattern(pattern, flags string) (string, bool) {
+	text, start, end, ok := LiteralMatch(pattern, flags)
+	if !ok {
+		return "", false
+	}
+	prefix, suffix := "%", "%"
+	if start {
+		prefix = ""
+	}
+	if end {
+		suffix = ""
+	}
+	return prefix + likeEscaper.Replace(text) + suffix, true
+}
@@ -0,0 +1,498 @@
+package memoryadapter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+// Record is a single record to filter, mapping field names to values.
+// Nested records are held as map[string]interface{} and arrays as
+// []interface{}, as produced by encoding/json.
+type Record map[string]interface{}
+
+// OperatorFunc evaluates a custom operator against a record. The Filter is
+// passed so that operands may be evaluated with f.Eval.
+type OperatorFunc func(f *Filter, n *rql.OperatorNode, r Record) (interface{}, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the evaluation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// Filter evaluates a parsed statement against records in memory, with the
+// same NULL semantics as the SQL generated by sqladapter: comparisons
+// involving a missing or null value are unknown, unknown predicates do not
+// match, and and/or follow three-valued logic. Values of different types,
+// such as a string and a number, are likewise incomparable.
+type Filter struct {
+	root    rql.Node
+	regexps map[*rql.OperatorNode]*regexp.Regexp
+}
+
+// Element is the identifier which refers to the array element itself
+// within the predicate of any or all
+const Element = "_"
+
+// NewFilter prepares the statement for evaluation
+func NewFilter(n rql.Node) (*Filter, error) {
+	f := &Filter{root: n, regexps: map[*rql.OperatorNode]*regexp.Regexp{}}
+	if err := f.compile(n); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// compile caches the regular expressions of match operators
+func (f *Filter) compile(n rql.Node) error {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator != nil {
+			return f.compile(n.Operator)
+		}
+	case *rql.OperatorNode:
+		if n.Operator == "match" {
+			re, err := rql.CompileMatch(n)
+			if err != nil {
+				return err
+			}
+			f.regexps[n] = re
+		}
+		return f.compile(n.Operands)
+	case *rql.FunctionNode:
+		return f.compile(n.Args)
+	case *rql.ListNode:
+		for _, v := range n.Nodes {
+			if err := f.compile(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Match reports whether the record satisfies the statement
+func Match(n rql.Node, r Record) (bool, error) {
+	f, err := NewFilter(n)
+	if err != nil {
+		return false, err
+	}
+	return f.Match(r)
+}
+
+// Match reports whether the record satisfies the statement. As in a SQL
+// WHERE clause, an unknown result does not match.
+func (f *Filter) Match(r Record) (bool, error) {
+	v, err := f.Eval(f.root, r)
+	if err != nil {
+		return false, err
+	}
+	b, _ := v.(bool)
+	return b, nil
+}
+
+// Eval evaluates the node against the record. Predicates evaluate to true,
+// false, or nil when unknown; numbers evaluate to float64.
+func (f *Filter) Eval(n rql.Node, r Record) (interface{}, error) {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator == nil {
+			return true, nil
+		}
+		return f.Eval(n.Operator, r)
+	case *rql.BoolNode:
+		return n.True, nil
+	case *rql.NullNode:
+		return nil, nil
+	case *rql.StringNode:
+		return n.Text, nil
+	case *rql.NumberNode:
+		return n.Float64, nil
+	case *rql.IdentifierNode:
+		return lookup(n, r), nil
+	case *rql.ListNode:
+		vals := []interface{}{}
+		for _, v := range n.Nodes {
+			val, err := f.Eval(v, r)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, val)
+		}
+		return vals, nil
+	case *rql.FunctionNode:
+		return f.function(n, r)
+	case *rql.OperatorNode:
+		if n == nil || len(n.Operands.Nodes) == 0 {
+			return true, nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(f, n, r)
+		}
+		return f.operator(n, r)
+	}
+	return nil, fmt.Errorf("cannot evaluate %s", n)
+}
+
+// operator evaluates a built-in operator
+func (f *Filter) operator(n *rql.OperatorNode, r Record) (interface{}, error) {
+	switch n.Operator {
+	case "and", "or":
+		return f.logical(n, r)
+	case "any", "all":
+		return f.quantified(n, r)
+	}
+	if len(n.Operands.Nodes) < 2 {
+		return nil, fmt.Errorf("%s expects 2 operands", n.Operator)
+	}
+	left, err := f.Eval(n.Operands.Nodes[0], r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := f.Eval(n.Operands.Nodes[1], r)
+	if err != nil {
+		return nil, err
+	}
+	isNull := n.Operands.Nodes[1].Type() == rql.NodeNull
+	switch n.Operator {
+	case "eq":
+		if isNull {
+			return left == nil, nil
+		}
+		return compare(left, right, func(c int) bool { return c == 0 }), nil
+	case "ne":
+		if isNull {
+			return left != nil, nil
+		}
+		return compare(left, right, func(c int) bool { return c != 0 }), nil
+	case "lt":
+		return compare(left, right, func(c int) bool { return c < 0 }), nil
+	case "gt":
+		return compare(left, right, func(c int) bool { return c > 0 }), nil
+	case "le":
+		return compare(left, right, func(c int) bool { return c <= 0 }), nil
+	case "ge":
+		return compare(left, right, func(c int) bool { return c >= 0 }), nil
+	case "in":
+		values, ok := right.([]interface{})
+		if !ok {
+			values = []interface{}{right}
+		}
+		return contains(values, left), nil
+	case "contains", "overlaps":
+		array, ok := left.([]interface{})
+		values, _ := right.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		for _, v := range values {
+			found := contains(array, v) == true
+			if found && n.Operator == "overlaps" {
+				return true, nil
+			}
+			if !found && n.Operator == "contains" {
+				return false, nil
+			}
+		}
+		return n.Operator == "contains", nil
+	case "size":
+		array, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return compare(float64(len(array)), right, func(c int) bool { return c == 0 }), nil
+	case "match":
+		s, ok := left.(string)
+		if !ok {
+			return nil, nil
+		}
+		return f.regexps[n].MatchString(s), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", n.Operator)
+}
+
+// logical evaluates and/or with three-valued logic
+func (f *Filter) logical(n *rql.OperatorNode, r Record) (interface{}, error) {
+	decisive := n.Operator == "or" // the value which settles the result
+	unknown := false
+	for _, v := range n.Operands.Nodes {
+		val, err := f.Eval(v, r)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := val.(bool)
+		switch {
+		case !ok:
+			unknown = true
+		case b == decisive:
+			return decisive, nil
+		}
+	}
+	if unknown {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
+// quantified evaluates any/all, whose predicate is evaluated against each
+// element of the array. Like x = ANY(array) in SQL, any is true when the
+// predicate is true for some element, and like x = ALL(array), all is false
+// when it is false for some element. Otherwise either is unknown if the
+// array is null or the predicate is unknown for some element.
+func (f *Filter) quantified(n *rql.OperatorNode, r Record) (interface{}, error) {
+	if len(n.Operands.Nodes) != 2 {
+		return nil, fmt.Errorf("%s expects 2 operands", n.Operator)
+	}
+	val, err := f.Eval(n.Operands.Nodes[0], r)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := val.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	unknown := false
+	for _, elem := range array {
+		scope := Record{}
+		if m, ok := elem.(map[string]interface{}); ok {
+			for k, v := range m {
+				scope[k] = v
+			}
+		}
+		scope[Element] = elem
+		res, err := f.Eval(n.Operands.Nodes[1], scope)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := res.(bool)
+		switch {
+		case !ok:
+			unknown = true
+		case n.Operator == "any" && b:
+			return true, nil
+		case n.Operator == "all" && !b:
+			return false, nil
+		}
+	}
+	if unknown {
+		return nil, nil
+	}
+	return n.Operator == "all", nil
+}
+
+// function evaluates a scalar function; functions of null are null
+func (f *Filter) function(n *rql.FunctionNode, r Record) (interface{}, error) {
+	args := []interface{}{}
+	for _, v := range n.Args.Nodes {
+		val, err := f.Eval(v, r)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			return nil, nil
+		}
+		args = append(args, val)
+	}
+	if _, ok := rql.Arithmetic[n.Name]; ok {
+		a, aok := number(args[0])
+		b, bok := number(args[1])
+		if !aok || !bok {
+			return nil, nil
+		}
+		switch n.Name {
+		case "add":
+			return a + b, nil
+		case "sub":
+			return a - b, nil
+		case "mul":
+			return a * b, nil
+		case "div", "mod":
+			if b == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if n.Name == "mod" {
+				return math.Mod(a, b), nil
+			}
+			return a / b, nil
+		}
+	}
+	switch n.Name {
+	case "lower", "upper", "trim", "length":
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, nil
+		}
+		switch n.Name {
+		case "lower":
+			return strings.ToLower(s), nil
+		case "upper":
+			return strings.ToUpper(s), nil
+		case "trim":
+			return strings.TrimSpace(s), nil
+		}
+		return float64(utf8.RuneCountInString(s)), nil
+	case "abs":
+		a, ok := number(args[0])
+		if !ok {
+			return nil, nil
+		}
+		return math.Abs(a), nil
+	case "year", "month", "day":
+		t, ok := timestamp(args[0])
+		if !ok {
+			return nil, nil
+		}
+		switch n.Name {
+		case "year":
+			return float64(t.Year()), nil
+		case "month":
+			return float64(t.Month()), nil
+		}
+		return float64(t.Day()), nil
+	}
+	return nil, fmt.Errorf("unknown function %q", n.Name)
+}
+
+// lookup returns the value of the field an identifier refers to, following
+// dotted paths into nested records
+func lookup(n *rql.IdentifierNode, r Record) interface{} {
+	if v, ok := r[n.Ident]; ok {
+		return v
+	}
+	var v interface{} = map[string]interface{}(r)
+	for _, p := range n.Path() {
+		switch m := v.(type) {
+		case map[string]interface{}:
+			v = m[p]
+		case Record:
+			v = m[p]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// contains reports whether v equals one of values: true if it does, nil if
+// it does not but either v or one of the values is null, and false otherwise
+func contains(values []interface{}, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	unknown := false
+	for _, val := range values {
+		switch compare(v, val, func(c int) bool { return c == 0 }) {
+		case true:
+			return true
+		case nil:
+			unknown = true
+		}
+	}
+	if unknown {
+		return nil
+	}
+	return false
+}
+
+// compare applies test to the ordering of a and b, returning nil if either
+// is null or they cannot be compared
+func compare(a, b interface{}, test func(int) bool) interface{} {
+	if a == nil || b == nil {
+		return nil
+	}
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return nil
+		}
+		switch {
+		case x < y:
+			return test(-1)
+		case x > y:
+			return test(1)
+		}
+		return test(0)
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return nil
+		}
+		return test(strings.Compare(x, y))
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return nil
+		}
+		switch {
+		case x == y:
+			return test(0)
+		case y:
+			return test(-1)
+		}
+		return test(1)
+	}
+	return nil
+}
+
+// number converts numeric values to float64
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// timestampLayouts are the layouts accepted for dates and timestamps
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// timestamp converts time values and strings holding timestamps to time.Time
+func timestamp(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
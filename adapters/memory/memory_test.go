@@ -0,0 +1,110 @@
+package memoryadapter
+
+import (
+	"encoding/json"
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+const testRecord = `{
+	"id": 12,
+	"name": "Jason",
+	"email": "Jason@Example.com",
+	"age": 34,
+	"vip": true,
+	"manager": null,
+	"created": "2024-03-05T10:00:00Z",
+	"address": {"city": "Paris"},
+	"tags": ["a", "b"],
+	"scores": [70, 95],
+	"manager_ids": [],
+	"items": [{"price": 5}, {"price": 15}]
+}`
+
+var matchTests = []struct {
+	name  string
+	input string
+	match bool
+}{
+	{"empty", "", true},
+	{"equals", "eq(id,12)", true},
+	{"not equals", "ne(id,12)", false},
+	{"less than", "lt(age,40)", true},
+	{"greater than", "gt(age,40)", false},
+	{"less than equals", "le(age,34)", true},
+	{"greater than equals", "ge(age,35)", false},
+	{"string", `eq(name,"Jason")`, true},
+	{"bool", "eq(vip,true)", true},
+	{"in", `in(name,("Kevin","Jason"))`, true},
+	{"not in", `in(name,("Kevin"))`, false},
+	{"and", "and(eq(id,12),lt(age,21))", false},
+	{"or", "or(eq(id,12),lt(age,21))", true},
+	{"nested path", `eq(address.city,"Paris")`, true},
+
+	// null semantics
+	{"is null", "eq(manager,null)", true},
+	{"is not null", "ne(manager,null)", false},
+	{"missing is null", "eq(missing,null)", true},
+	{"compare null", "eq(manager,1)", false},
+	{"not equals null", "ne(manager,1)", false},
+	{"or with unknown", "or(eq(manager,1),eq(id,12))", true},
+	{"and with unknown", "and(eq(manager,1),eq(id,12))", false},
+	{"in with null", "in(manager,(1,2))", false},
+	{"mismatched types", `eq(id,"12")`, false},
+
+	// functions
+	{"lower", `eq(lower(email),"jason@example.com")`, true},
+	{"length", `eq(length(name),5)`, true},
+	{"year", `eq(year(created),2024)`, true},
+	{"arithmetic", `gt(mul(age,2),60)`, true},
+	{"arithmetic null", `gt(add(manager,1),0)`, false},
+
+	// arrays
+	{"contains", `contains(tags,("a","b"))`, true},
+	{"contains missing", `contains(tags,("a","c"))`, false},
+	{"overlaps", `overlaps(tags,("c","b"))`, true},
+	{"size", `size(tags,2)`, true},
+	{"any element", `any(scores,gt(_,90))`, true},
+	{"all element", `all(scores,gt(_,90))`, false},
+	{"any field", `any(items,gt(price,10))`, true},
+	{"all field", `all(items,gt(price,1))`, true},
+	{"any of null", `any(manager,gt(price,1))`, false},
+	{"all of null", `all(manager,gt(price,1))`, false},
+	{"all of empty", `all(manager_ids,gt(_,1))`, true},
+	{"all unknown", `all(items,gt(discount,1))`, false},
+
+	{"match", `match(name,"^ja","i")`, true},
+	{"no match", `match(name,"^ja")`, false},
+}
+
+func TestMatch(t *testing.T) {
+	record := Record{}
+	if err := json.Unmarshal([]byte(testRecord), &record); err != nil {
+		t.Fatalf("unexpected record failure: %v", err)
+	}
+	for _, test := range matchTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		got, err := Match(stmt.Root, record)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.match {
+			t.Errorf("%s: expected %t got %t", test.name, test.match, got)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	stmt, err := rql.New("div").Parse("eq(div(id,0),1)")
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	if _, err := Match(stmt.Root, Record{"id": 1.0}); err == nil {
+		t.Errorf("expected error; got none")
+	}
+}
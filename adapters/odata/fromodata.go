@@ -0,0 +1,564 @@
+package odataadapter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zikes/rql/adapters/internal/convert"
+	rql "github.com/zikes/rql/parse"
+)
+
+// FromOData parses an OData $filter expression into an RQL parse tree. It
+// accepts the comparison and logical operators, in, arithmetic, the lambda
+// operators any and all, the string functions contains, startswith,
+// endswith, matchesPattern, tolower, toupper, trim and length, and the date
+// functions year, month and day. Property paths such as Address/City
+// become dotted identifiers.
+//
+// RQL has no negation, so not is applied to the conditions beneath it, and
+// conditions which cannot be negated, such as not contains(...), are
+// rejected.
+func FromOData(name, text string) (tree *rql.Tree, err error) {
+	p := &odataParser{name: name, text: text}
+	defer convert.Recover(&err)
+	p.scan()
+	src := ""
+	if p.peek().kind != odataEOF {
+		src = p.condition(p.or()).String()
+		if tok := p.peek(); tok.kind != odataEOF {
+			p.unexpected(tok)
+		}
+	}
+	tree, err = rql.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%v in translation %s", err, src)
+	}
+	return tree, nil
+}
+
+// exprKind classifies translated expressions
+type exprKind int
+
+const (
+	exprValue     exprKind = iota // property, function call or arithmetic
+	exprLiteral                   // string, number, boolean or null
+	exprCondition                 // boolean operator
+	exprList                      // parenthesized list of values
+)
+
+// expr is a translated OData expression, held as a tree so that not can be
+// applied to the conditions beneath it
+type expr struct {
+	kind exprKind
+	pos  int     // byte offset of the expression in the text
+	op   string  // RQL operator or function, empty for leaves
+	args []*expr // operands of op, or members of a list
+	text string  // RQL text of a leaf
+}
+
+// String returns the RQL text of the expression
+func (e *expr) String() string {
+	args := []string{}
+	for _, a := range e.args {
+		args = append(args, a.String())
+	}
+	switch {
+	case e.kind == exprList:
+		return "(" + strings.Join(args, ",") + ")"
+	case e.op == "":
+		return e.text
+	}
+	return e.op + "(" + strings.Join(args, ",") + ")"
+}
+
+// odataTokenKind identifies the type of an OData token
+type odataTokenKind int
+
+const (
+	odataEOF    odataTokenKind = iota
+	odataIdent                 // identifier, keyword or operator
+	odataString                // string literal
+	odataNumber                // numeric literal
+	odataSymbol                // punctuation
+)
+
+// odataToken is a token of OData text
+type odataToken struct {
+	kind odataTokenKind
+	val  string // text of the token, unquoted for strings
+	pos  int    // byte offset of the token in the text
+	end  int    // byte offset following the token
+}
+
+// comparisonOps are the OData comparison operators, which RQL shares
+var comparisonOps = map[string]bool{
+	"eq": true, "ne": true, "lt": true, "gt": true, "le": true, "ge": true,
+}
+
+// odataParser translates OData text into an expression tree. Errors are
+// raised by panicking with an *rql.Error, which is recovered by FromOData.
+type odataParser struct {
+	name   string
+	text   string
+	tokens []odataToken
+	next   int      // index of the next token
+	vars   []string // lambda variables in scope, innermost last
+}
+
+// errorf raises an error at the given byte offset of the text
+func (p *odataParser) errorf(pos int, format string, args ...interface{}) {
+	panic(convert.ErrorAt(p.name, p.text, pos, fmt.Sprintf(format, args...)))
+}
+
+// unexpected raises an error for an unexpected token
+func (p *odataParser) unexpected(tok odataToken) {
+	if tok.kind == odataEOF {
+		p.errorf(tok.pos, "unexpected end of expression")
+	}
+	p.errorf(tok.pos, "unexpected %s", p.text[tok.pos:tok.end])
+}
+
+// scan splits the text into tokens, ending with an odataEOF token
+func (p *odataParser) scan() {
+	for i := 0; ; {
+		for i < len(p.text) && strings.IndexByte(" \t\r\n", p.text[i]) >= 0 {
+			i++
+		}
+		if i == len(p.text) {
+			p.tokens = append(p.tokens, odataToken{kind: odataEOF, pos: i, end: i})
+			return
+		}
+		tok := odataToken{pos: i}
+		switch c := p.text[i]; {
+		case c == '\'':
+			tok.kind = odataString
+			i, tok.val = p.scanString(i)
+		case isDigit(c):
+			tok.kind = odataNumber
+			for i < len(p.text) && isDigit(p.text[i]) {
+				i++
+			}
+			if i+1 < len(p.text) && p.text[i] == '.' && isDigit(p.text[i+1]) {
+				for i++; i < len(p.text) && isDigit(p.text[i]); i++ {
+				}
+			}
+			if i < len(p.text) && isIdentStart(p.text[i]) {
+				p.errorf(tok.pos, "bad number syntax: %q", p.text[tok.pos:i+1])
+			}
+			tok.val = p.text[tok.pos:i]
+		case isIdentStart(c):
+			tok.kind = odataIdent
+			for i < len(p.text) && (isIdentStart(p.text[i]) || isDigit(p.text[i])) {
+				i++
+			}
+			tok.val = p.text[tok.pos:i]
+		case strings.IndexByte("(),/:-", c) >= 0:
+			tok.kind = odataSymbol
+			tok.val = p.text[i : i+1]
+			i++
+		default:
+			p.errorf(i, "unrecognized character %q", c)
+		}
+		tok.end = i
+		p.tokens = append(p.tokens, tok)
+	}
+}
+
+// scanString scans a string literal starting at i, returning the offset
+// following it and its unquoted text
+func (p *odataParser) scanString(i int) (int, string) {
+	var b strings.Builder
+	for j := i + 1; j < len(p.text); j++ {
+		if p.text[j] != '\'' {
+			b.WriteByte(p.text[j])
+			continue
+		}
+		if j+1 < len(p.text) && p.text[j+1] == '\'' {
+			b.WriteByte('\'')
+			j++
+			continue
+		}
+		return j + 1, b.String()
+	}
+	p.errorf(i, "unterminated quoted string")
+	return 0, ""
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// peek returns the next token without consuming it
+func (p *odataParser) peek() odataToken {
+	return p.tokens[p.next]
+}
+
+// advance consumes and returns the next token
+func (p *odataParser) advance() odataToken {
+	tok := p.tokens[p.next]
+	if tok.kind != odataEOF {
+		p.next++
+	}
+	return tok
+}
+
+// isSymbol reports whether the token is the given punctuation
+func isSymbol(tok odataToken, s string) bool {
+	return tok.kind == odataSymbol && tok.val == s
+}
+
+// isWord reports whether the token is the given keyword or operator
+func isWord(tok odataToken, word string) bool {
+	return tok.kind == odataIdent && tok.val == word
+}
+
+// symbol consumes the next token if it is the given punctuation
+func (p *odataParser) symbol(s string) bool {
+	if isSymbol(p.peek(), s) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// word consumes the next token if it is the given keyword or operator
+func (p *odataParser) word(word string) bool {
+	if isWord(p.peek(), word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// expect consumes the given punctuation, raising an error if it is missing
+func (p *odataParser) expect(s string) {
+	if !p.symbol(s) {
+		p.unexpected(p.peek())
+	}
+}
+
+// condition returns e as a condition, comparing a bare boolean property or
+// function with true
+func (p *odataParser) condition(e *expr) *expr {
+	switch e.kind {
+	case exprCondition:
+		return e
+	case exprValue:
+		return &expr{kind: exprCondition, pos: e.pos, op: "eq", args: []*expr{e, {kind: exprLiteral, text: "true"}}}
+	}
+	p.errorf(e.pos, "expected a condition")
+	return nil
+}
+
+// value checks that e is a value rather than a condition
+func (p *odataParser) value(e *expr) *expr {
+	if e.kind == exprCondition || e.kind == exprList {
+		p.errorf(e.pos, "expected a value")
+	}
+	return e
+}
+
+// logical joins conditions with and or or, flattening nested operators
+func logical(op string, conds []*expr) *expr {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	e := &expr{kind: exprCondition, pos: conds[0].pos, op: op}
+	for _, c := range conds {
+		if c.op == op {
+			e.args = append(e.args, c.args...)
+		} else {
+			e.args = append(e.args, c)
+		}
+	}
+	return e
+}
+
+// or parses expressions joined by or
+func (p *odataParser) or() *expr {
+	e := p.and()
+	if !isWord(p.peek(), "or") {
+		return e
+	}
+	conds := []*expr{p.condition(e)}
+	for p.word("or") {
+		conds = append(conds, p.condition(p.and()))
+	}
+	return logical("or", conds)
+}
+
+// and parses expressions joined by and
+func (p *odataParser) and() *expr {
+	e := p.comparison()
+	if !isWord(p.peek(), "and") {
+		return e
+	}
+	conds := []*expr{p.condition(e)}
+	for p.word("and") {
+		conds = append(conds, p.condition(p.comparison()))
+	}
+	return logical("and", conds)
+}
+
+// comparison parses a sum, optionally compared with another or tested for
+// membership of a list
+func (p *odataParser) comparison() *expr {
+	left := p.additive()
+	tok := p.peek()
+	switch {
+	case tok.kind == odataIdent && comparisonOps[tok.val]:
+		p.advance()
+		left, right, op := p.value(left), p.value(p.additive()), tok.val
+		if left.kind == exprLiteral && right.kind != exprLiteral {
+			left, right, op = right, left, convert.Swapped[op]
+		}
+		return &expr{kind: exprCondition, pos: left.pos, op: op, args: []*expr{left, right}}
+	case isWord(tok, "in"):
+		p.advance()
+		list := p.primary()
+		if list.kind != exprList {
+			list = &expr{kind: exprList, pos: list.pos, args: []*expr{list}}
+		}
+		return &expr{kind: exprCondition, pos: left.pos, op: "in", args: []*expr{p.value(left), list}}
+	case isWord(tok, "has"):
+		p.errorf(tok.pos, "has cannot be expressed in RQL")
+	}
+	return left
+}
+
+// additive parses a sum
+func (p *odataParser) additive() *expr {
+	left := p.multiplicative()
+	for tok := p.peek(); isWord(tok, "add") || isWord(tok, "sub"); tok = p.peek() {
+		p.advance()
+		left = p.arithmetic(tok, left, p.multiplicative())
+	}
+	return left
+}
+
+// multiplicative parses a product
+func (p *odataParser) multiplicative() *expr {
+	left := p.unary()
+	for tok := p.peek(); isWord(tok, "mul") || isWord(tok, "div") || isWord(tok, "mod") || isWord(tok, "divby"); tok = p.peek() {
+		p.advance()
+		if tok.val == "divby" {
+			p.errorf(tok.pos, "divby cannot be expressed in RQL")
+		}
+		left = p.arithmetic(tok, left, p.unary())
+	}
+	return left
+}
+
+// arithmetic returns the RQL function call for an arithmetic operator,
+// whose names RQL shares
+func (p *odataParser) arithmetic(tok odataToken, left, right *expr) *expr {
+	return &expr{kind: exprValue, pos: left.pos, op: tok.val, args: []*expr{p.value(left), p.value(right)}}
+}
+
+// unary parses not, a negative number or a primary expression
+func (p *odataParser) unary() *expr {
+	tok := p.peek()
+	switch {
+	case isWord(tok, "not"):
+		p.advance()
+		return p.negate(p.condition(p.unary()))
+	case isSymbol(tok, "-"):
+		p.advance()
+		num := p.advance()
+		if num.kind != odataNumber {
+			p.errorf(tok.pos, "only numbers can be negated")
+		}
+		return &expr{kind: exprLiteral, pos: tok.pos, text: "-" + num.val}
+	}
+	return p.primary()
+}
+
+// negate returns the negation of a condition
+func (p *odataParser) negate(e *expr) *expr {
+	switch e.op {
+	case "and", "or":
+		conds := []*expr{}
+		for _, c := range e.args {
+			conds = append(conds, p.negate(c))
+		}
+		if e.op == "and" {
+			return logical("or", conds)
+		}
+		return logical("and", conds)
+	case "eq", "ne", "lt", "gt", "le", "ge":
+		return &expr{kind: exprCondition, pos: e.pos, op: convert.Negated[e.op], args: e.args}
+	case "in":
+		conds := []*expr{}
+		for _, v := range e.args[1].args {
+			conds = append(conds, &expr{kind: exprCondition, pos: e.pos, op: "ne", args: []*expr{e.args[0], v}})
+		}
+		return logical("and", conds)
+	case "any", "all":
+		// not any(x: p) is all(x: not p)
+		op := "all"
+		if e.op == "all" {
+			op = "any"
+		}
+		return &expr{kind: exprCondition, pos: e.pos, op: op, args: []*expr{e.args[0], p.negate(e.args[1])}}
+	}
+	p.errorf(e.pos, "not %s cannot be expressed in RQL", e.op)
+	return nil
+}
+
+// primary parses a literal, parenthesized expression or list, property
+// path or function call
+func (p *odataParser) primary() *expr {
+	tok := p.advance()
+	switch tok.kind {
+	case odataNumber:
+		return &expr{kind: exprLiteral, pos: tok.pos, text: tok.val}
+	case odataString:
+		return &expr{kind: exprLiteral, pos: tok.pos, text: strconv.Quote(tok.val)}
+	case odataSymbol:
+		if tok.val == "(" {
+			e := p.or()
+			if !isSymbol(p.peek(), ",") {
+				p.expect(")")
+				return e
+			}
+			list := &expr{kind: exprList, pos: tok.pos, args: []*expr{p.value(e)}}
+			for p.symbol(",") {
+				list.args = append(list.args, p.value(p.additive()))
+			}
+			p.expect(")")
+			return list
+		}
+	case odataIdent:
+		switch tok.val {
+		case "true", "false", "null":
+			return &expr{kind: exprLiteral, pos: tok.pos, text: tok.val}
+		}
+		if p.symbol("(") {
+			return p.function(tok)
+		}
+		return p.path(tok)
+	}
+	p.unexpected(tok)
+	return nil
+}
+
+// path parses a property path starting with tok, and any lambda operator
+// applied to it
+func (p *odataParser) path(tok odataToken) *expr {
+	segments := []string{tok.val}
+	for isSymbol(p.peek(), "/") {
+		p.advance()
+		seg := p.advance()
+		if seg.kind != odataIdent {
+			p.unexpected(seg)
+		}
+		if (seg.val == "any" || seg.val == "all") && isSymbol(p.peek(), "(") {
+			p.advance()
+			return p.lambda(seg, p.property(tok, segments))
+		}
+		segments = append(segments, seg.val)
+	}
+	return p.property(tok, segments)
+}
+
+// property resolves a property path, relative to the innermost lambda
+// variable within any or all
+func (p *odataParser) property(tok odataToken, segments []string) *expr {
+	if len(p.vars) > 0 {
+		if segments[0] != p.vars[len(p.vars)-1] {
+			p.errorf(tok.pos, "only properties of the lambda variable can be used within any or all")
+		}
+		segments = segments[1:]
+		if len(segments) == 0 {
+			return &expr{kind: exprValue, pos: tok.pos, text: Element}
+		}
+	}
+	ident := strings.Join(segments, ".")
+	if !convert.ValidIdentifier(ident) {
+		p.errorf(tok.pos, "%q is not a valid RQL identifier", ident)
+	}
+	return &expr{kind: exprValue, pos: tok.pos, text: ident}
+}
+
+// lambda parses the variable and predicate of any or all following the
+// opening parenthesis
+func (p *odataParser) lambda(tok odataToken, collection *expr) *expr {
+	v := p.advance()
+	if v.kind != odataIdent {
+		p.errorf(tok.pos, "%s without a predicate cannot be expressed in RQL", tok.val)
+	}
+	p.expect(":")
+	p.vars = append(p.vars, v.val)
+	pred := p.condition(p.or())
+	p.vars = p.vars[:len(p.vars)-1]
+	p.expect(")")
+	return &expr{kind: exprCondition, pos: collection.pos, op: tok.val, args: []*expr{collection, pred}}
+}
+
+// rqlFunctions maps OData functions to RQL functions
+var rqlFunctions = map[string]string{}
+
+func init() {
+	for name, fn := range functions {
+		rqlFunctions[fn] = name
+	}
+}
+
+// function parses the arguments of a function call following its opening
+// parenthesis
+func (p *odataParser) function(tok odataToken) *expr {
+	args := []*expr{}
+	if !p.symbol(")") {
+		for {
+			args = append(args, p.value(p.or()))
+			if p.symbol(")") {
+				break
+			}
+			p.expect(",")
+		}
+	}
+	name := strings.ToLower(tok.val)
+	switch name {
+	case "contains", "startswith", "endswith", "matchespattern":
+		if len(args) != 2 || !strings.HasPrefix(args[1].text, `"`) {
+			p.errorf(tok.pos, "%s expects a property and a string", tok.val)
+		}
+		text, _ := strconv.Unquote(args[1].text)
+		return p.match(name, args[0], text)
+	}
+	fn, ok := rqlFunctions[name]
+	if !ok {
+		p.errorf(tok.pos, "function %s cannot be expressed in RQL", tok.val)
+	}
+	return &expr{kind: exprValue, pos: tok.pos, op: fn, args: args}
+}
+
+// match returns an RQL match for a string function. A lowercase string
+// searched for in tolower(x) becomes a case-insensitive match of x.
+func (p *odataParser) match(fn string, left *expr, text string) *expr {
+	if fn == "matchespattern" {
+		return &expr{kind: exprCondition, pos: left.pos, op: "match", args: []*expr{left, {kind: exprLiteral, text: strconv.Quote(text)}}}
+	}
+	flags := ""
+	if left.op == "lower" && strings.ToLower(text) == text {
+		left, flags = left.args[0], "i"
+	}
+	pattern := regexp.QuoteMeta(text)
+	switch fn {
+	case "startswith":
+		pattern = "^" + pattern
+	case "endswith":
+		pattern += "$"
+	}
+	args := []*expr{left, {kind: exprLiteral, text: strconv.Quote(pattern)}}
+	if flags != "" {
+		args = append(args, &expr{kind: exprLiteral, text: strconv.Quote(flags)})
+	}
+	return &expr{kind: exprCondition, pos: left.pos, op: "match", args: args}
+}
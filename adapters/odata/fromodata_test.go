@@ -0,0 +1,134 @@
+package odataadapter
+
+import (
+	"strings"
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+var fromODataTests = []struct {
+	name   string
+	input  string
+	result string
+}{
+	{"empty", "", ""},
+	{"gateway", `Age gt 21 and startswith(Name,'J')`, `and(gt(Age,21),match(Name,"^J"))`},
+	{"precedence", `a eq 1 or b eq 2 and c eq 3`, `or(eq(a,1),and(eq(b,2),eq(c,3)))`},
+	{"grouping", `(a eq 1 or b eq 2) and c eq 3`, `and(or(eq(a,1),eq(b,2)),eq(c,3))`},
+	{"flattened", `a eq 1 and b eq 2 and (c eq 3 and d eq 4)`, `and(eq(a,1),eq(b,2),eq(c,3),eq(d,4))`},
+
+	// comparisons
+	{"swapped", `21 lt Age`, `gt(Age,21)`},
+	{"negative", `Balance ge -10.5`, `ge(Balance,-10.5)`},
+	{"escaped string", `Name eq 'O''Brien'`, `eq(Name,"O'Brien")`},
+	{"in", `Name in ('a', 'b')`, `in(Name,("a","b"))`},
+	{"in one", `Name in ('a')`, `in(Name,("a"))`},
+	{"null", `Manager eq null`, `eq(Manager,null)`},
+	{"bare boolean", `IsActive and not Deleted`, `and(eq(IsActive,true),ne(Deleted,true))`},
+
+	// negation
+	{"not", `not (Age lt 21 or Name eq 'x')`, `and(ge(Age,21),ne(Name,"x"))`},
+	{"not in", `not (Id in (1,2))`, `and(ne(Id,1),ne(Id,2))`},
+	{"not any", `not Tags/any(t: t eq 'x')`, `all(Tags,ne(_,"x"))`},
+
+	// functions
+	{"contains", `contains(Name,'a.b')`, `match(Name,"a\\.b")`},
+	{"endswith", `endswith(Name,'son')`, `match(Name,"son$")`},
+	{"case-insensitive", `contains(tolower(Name),'jo')`, `match(Name,"jo","i")`},
+	{"uppercase tolower", `contains(tolower(Name),'Jo')`, `match(lower(Name),"Jo")`},
+	{"matchesPattern", `matchesPattern(Name,'^J.*n$')`, `match(Name,"^J.*n$")`},
+	{"scalar", `length(trim(Name)) gt 3 and year(Born) eq 1990`, `and(gt(length(trim(Name)),3),eq(year(Born),1990))`},
+	{"arithmetic", `Price mul 1.2 add 5 gt 100`, `gt(add(mul(Price,1.2),5),100)`},
+
+	// paths and lambdas
+	{"path", `Address/City eq 'Oslo'`, `eq(Address.City,"Oslo")`},
+	{"any", `Orders/any(o: o/Total gt 100)`, `any(Orders,gt(Total,100))`},
+	{"nested any", `Orders/any(o: o/Lines/all(l: l/Qty gt 0))`, `any(Orders,all(Lines,gt(Qty,0)))`},
+}
+
+func TestFromOData(t *testing.T) {
+	for _, test := range fromODataTests {
+		tree, err := FromOData(test.name, test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := tree.Root.String(); got != test.result {
+			t.Errorf("%s: RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+var fromODataErrorTests = []struct {
+	name  string
+	input string
+	err   string
+}{
+	{"unterminated", `Name eq 'bob`, `statement: unterminated:1: unterminated quoted string`},
+	{"missing operand", `a eq 1 and`, `statement: missing operand:1: unexpected end of expression`},
+	{"not contains", `not contains(Name,'x')`, `statement: not contains:1: not match cannot be expressed in RQL`},
+	{"function", `round(Price) eq 3`, `statement: function:1: function round cannot be expressed in RQL`},
+	{"outer property", `Orders/any(o: Total gt 1)`, `only properties of the lambda variable can be used within any or all`},
+	{"not a condition", `Age`, ``},
+	{"literal condition", `'x'`, `expected a condition`},
+	{"has", `Style has 'Yellow'`, `has cannot be expressed in RQL`},
+	{"type", `length(Name) eq 'x'`, `in translation eq(length(Name),"x")`},
+}
+
+func TestFromODataErrors(t *testing.T) {
+	for _, test := range fromODataErrorTests {
+		_, err := FromOData(test.name, test.input)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q got %q", test.name, test.err, err)
+		}
+	}
+}
+
+// equivalents are the trees which come back from OData in a different
+// but equivalent form
+var equivalents = map[string]string{
+	"exact":            `eq(name,"Jo")`,
+	"case-insensitive": `match(name,"^jo","i")`,
+	"in operands":      `in(id,(1,2,3))`,
+	"in single":        `in(id,(1))`,
+}
+
+// TestRoundTrip checks that the OData written by ToOData is parsed back
+// into the same tree
+func TestRoundTrip(t *testing.T) {
+	for _, test := range parseTests {
+		input := test.input
+		if eq, ok := equivalents[test.name]; ok {
+			input = eq
+		}
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		odata, err := ToOData(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		tree, err := FromOData(test.name, odata)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		want, _ := rql.Format(test.name, input)
+		if got := rql.DefaultPrinter.Format(tree); got != want {
+			t.Errorf("%s: RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s\n\tvia:\n\t\t%s", test.name, want, got, odata)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package odataadapter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/zikes/rql/adapters/internal/translate"
+	rql "github.com/zikes/rql/parse"
+)
+
+// Element is the identifier which refers to the collection member itself
+// within the predicate of any or all
+const Element = "_"
+
+// Translator converts RQL nodes into OData $filter expressions
+type Translator struct {
+	scope string // name of the lambda variable within any/all
+	depth int    // nesting depth of any/all
+}
+
+// OperatorFunc translates a custom operator into OData. The Translator is
+// passed so that operands may be translated with t.ToOData.
+type OperatorFunc func(t *Translator, n *rql.OperatorNode) (string, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by ToOData
+var DefaultTranslator = &Translator{}
+
+// ToOData converts the node into an OData $filter expression using the
+// DefaultTranslator
+func ToOData(n rql.Node) (string, error) {
+	return DefaultTranslator.ToOData(n)
+}
+
+// ToOData converts the node into an OData $filter expression. Dotted
+// identifiers become property paths, match patterns which are only literal
+// text become contains, startswith, endswith or eq, and other patterns
+// become the OData 4.01 matchesPattern. The array operators contains,
+// overlaps and size have no OData equivalent and return an error.
+func (t *Translator) ToOData(n rql.Node) (string, error) {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator == nil {
+			return "", nil
+		}
+		return t.ToOData(n.Operator)
+	case *rql.BoolNode:
+		return fmt.Sprintf("%v", n.True), nil
+	case *rql.NullNode:
+		return "null", nil
+	case *rql.IdentifierNode:
+		return t.property(n), nil
+	case *rql.FunctionNode:
+		return t.function(n)
+	case *rql.StringNode:
+		return quote(n.Text), nil
+	case *rql.NumberNode:
+		return n.Text, nil
+	case *rql.ListNode:
+		str := []string{}
+		for _, v := range n.Nodes {
+			s, err := t.ToOData(v)
+			if err != nil {
+				return "", err
+			}
+			str = append(str, s)
+		}
+		return "(" + strings.Join(str, ",") + ")", nil
+	case *rql.OperatorNode:
+		if n == nil || len(n.Operands.Nodes) == 0 {
+			return "", nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, n)
+		}
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge", "any", "all":
+			if len(n.Operands.Nodes) != 2 {
+				return "", fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
+			}
+		}
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			return t.infix(n.Operator, n.Operands.Nodes[0], n.Operands.Nodes[1])
+		case "in":
+			return t.in(n)
+		case "match":
+			return t.match(n)
+		case "any", "all":
+			array, err := t.ToOData(n.Operands.Nodes[0])
+			if err != nil {
+				return "", err
+			}
+			sub := t.scoped()
+			pred, err := sub.ToOData(n.Operands.Nodes[1])
+			if err != nil {
+				return "", err
+			}
+			return array + "/" + n.Operator + "(" + sub.scope + ":" + pred + ")", nil
+		case "and", "or":
+			str := []string{}
+			for _, v := range n.Operands.Nodes {
+				s, err := t.ToOData(v)
+				if err != nil {
+					return "", err
+				}
+				if op, ok := v.(*rql.OperatorNode); ok && (op.Operator == "and" || op.Operator == "or") {
+					s = "(" + s + ")"
+				}
+				str = append(str, s)
+			}
+			return strings.Join(str, " "+n.Operator+" "), nil
+		}
+		return "", fmt.Errorf("operator %s has no OData equivalent", n.Operator)
+	}
+	return "", fmt.Errorf("unexpected node %s", n)
+}
+
+// infix renders a binary operator
+func (t *Translator) infix(op string, left, right rql.Node) (string, error) {
+	l, err := t.ToOData(left)
+	if err != nil {
+		return "", err
+	}
+	r, err := t.ToOData(right)
+	if err != nil {
+		return "", err
+	}
+	return l + " " + op + " " + r, nil
+}
+
+// in renders membership in a list of values, given either as a single list
+// or as the remaining operands, which is always parenthesized
+func (t *Translator) in(n *rql.OperatorNode) (string, error) {
+	if len(n.Operands.Nodes) < 2 {
+		return "", fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
+	}
+	left, err := t.ToOData(n.Operands.Nodes[0])
+	if err != nil {
+		return "", err
+	}
+	values := n.Operands.Nodes[1:]
+	if len(values) == 1 {
+		if list, ok := values[0].(*rql.ListNode); ok {
+			values = list.Nodes
+		}
+	}
+	str := []string{}
+	for _, v := range values {
+		s, err := t.ToOData(v)
+		if err != nil {
+			return "", err
+		}
+		str = append(str, s)
+	}
+	return left + " in (" + strings.Join(str, ",") + ")", nil
+}
+
+// match renders a regular expression match. Patterns consisting of literal
+// text become string functions, with tolower for case-insensitive matches.
+func (t *Translator) match(n *rql.OperatorNode) (string, error) {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return "", err
+	}
+	left, err := t.ToOData(n.Operands.Nodes[0])
+	if err != nil {
+		return "", err
+	}
+	text, start, end, ok := translate.LiteralMatch(pattern, flags)
+	if !ok {
+		if flags != "" {
+			return "", fmt.Errorf("match flags %q have no OData equivalent", flags)
+		}
+		return "matchesPattern(" + left + "," + quote(pattern) + ")", nil
+	}
+	if strings.Contains(flags, "i") {
+		left, text = "tolower("+left+")", strings.ToLower(text)
+	}
+	switch {
+	case start && end:
+		return left + " eq " + quote(text), nil
+	case start:
+		return "startswith(" + left + "," + quote(text) + ")", nil
+	case end:
+		return "endswith(" + left + "," + quote(text) + ")", nil
+	}
+	return "contains(" + left + "," + quote(text) + ")", nil
+}
+
+// functions maps RQL functions to the OData functions of the same meaning
+var functions = map[string]string{
+	"lower":  "tolower",
+	"upper":  "toupper",
+	"trim":   "trim",
+	"length": "length",
+	"year":   "year",
+	"month":  "month",
+	"day":    "day",
+}
+
+// function renders a scalar function call, with arithmetic functions as
+// their infix operators
+func (t *Translator) function(n *rql.FunctionNode) (string, error) {
+	args := []string{}
+	for _, v := range n.Args.Nodes {
+		s, err := t.ToOData(v)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, s)
+	}
+	if _, ok := rql.Arithmetic[n.Name]; ok {
+		return "(" + strings.Join(args, " "+n.Name+" ") + ")", nil
+	}
+	name, ok := functions[n.Name]
+	if !ok {
+		return "", fmt.Errorf("function %s has no OData equivalent", n.Name)
+	}
+	return name + "(" + strings.Join(args, ",") + ")", nil
+}
+
+// scoped returns a copy of the Translator which resolves identifiers
+// against the lambda variable of any or all
+func (t *Translator) scoped() *Translator {
+	sub := *t
+	sub.depth++
+	sub.scope = "elem"
+	if sub.depth > 1 {
+		sub.scope = fmt.Sprintf("elem%d", sub.depth)
+	}
+	return &sub
+}
+
+// property renders an identifier as a property path
+func (t *Translator) property(n *rql.IdentifierNode) string {
+	path := strings.Join(n.Path(), "/")
+	if t.scope != "" {
+		if n.Ident == Element {
+			return t.scope
+		}
+		return t.scope + "/" + path
+	}
+	return path
+}
+
+// quote returns s as a single-quoted OData string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
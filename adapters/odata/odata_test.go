@@ -0,0 +1,108 @@
+package odataadapter
+
+import (
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+type parseTest struct {
+	name   string
+	input  string
+	result string
+}
+
+var parseTests = []parseTest{
+	{"empty", "", ``},
+	{"nested", "and(eq(id,12),or(lt(age,21),gt(height,156.2)))", `id eq 12 and (age lt 21 or height gt 156.2)`},
+
+	// operators
+	{"equals", "eq(id,12)", `id eq 12`},
+	{"not equals", "ne(id,12)", `id ne 12`},
+	{"less than", "lt(id,12)", `id lt 12`},
+	{"greater than", "gt(id,12)", `id gt 12`},
+	{"less than equals", "le(id,12)", `id le 12`},
+	{"greater than equals", "ge(id,12)", `id ge 12`},
+	{"in", `in(name,("a","b"))`, `name in ('a','b')`},
+	{"in operands", `in(id,1,2,3)`, `id in (1,2,3)`},
+	{"in single", `in(id,1)`, `id in (1)`},
+	{"any element", `any(tags,eq(_,"a"))`, `tags/any(elem:elem eq 'a')`},
+	{"nested any", `any(orders,any(lines,eq(sku,12)))`, `orders/any(elem:elem/lines/any(elem2:elem2/sku eq 12))`},
+	{"all", `all(items,gt(price,10))`, `items/all(elem:elem/price gt 10)`},
+
+	// match
+	{"contains", `match(name,"J.R")`, `matchesPattern(name,'J.R')`},
+	{"contains literal", `match(name,"J\\.R")`, `contains(name,'J.R')`},
+	{"startswith", `match(name,"^J")`, `startswith(name,'J')`},
+	{"endswith", `match(name,"son$")`, `endswith(name,'son')`},
+	{"exact", `match(name,"^Jo$")`, `name eq 'Jo'`},
+	{"case-insensitive", `match(name,"^Jo","i")`, `startswith(tolower(name),'jo')`},
+
+	// operands
+	{"path", `eq(address.city,"Oslo")`, `address/city eq 'Oslo'`},
+	{"function", `eq(lower(email),"x@y.com")`, `tolower(email) eq 'x@y.com'`},
+	{"arithmetic", `gt(mul(price,1.2),100)`, `(price mul 1.2) gt 100`},
+	{"null", "eq(id,null)", `id eq null`},
+	{"bool", "eq(id,true)", `id eq true`},
+	{"string", `eq(name,"O'Brien")`, `name eq 'O''Brien'`},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, err := ToOData(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: OData mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, input := range []string{
+		`contains(tags,(1,2))`,
+		`size(tags,3)`,
+		`match(name,"^a.c","i")`,
+		`eq(abs(balance),3)`,
+		`eq(id)`,
+		`eq(id,1,2)`,
+		`in(id)`,
+		`any(tags)`,
+	} {
+		stmt, err := rql.New(input).Parse(input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		if got, err := ToOData(stmt.Root); err == nil {
+			t.Errorf("%s: expected an error, got %s", input, got)
+		}
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "hasRole", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	RegisterOperator("hasRole", func(t *Translator, n *rql.OperatorNode) (string, error) {
+		role, err := t.ToOData(n.Operands.Nodes[1])
+		if err != nil {
+			return "", err
+		}
+		return "roles/any(r:r eq " + role + ")", nil
+	})
+	stmt, err := rql.New("custom").Parse(`and(hasRole(user,"admin"),eq(id,12))`)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	want := `roles/any(r:r eq 'admin') and id eq 12`
+	if got, err := ToOData(stmt.Root); err != nil || got != want {
+		t.Errorf("OData mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s (%v)", want, got, err)
+	}
+}
@@ -0,0 +1,816 @@
+package sqladapter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zikes/rql/adapters/internal/convert"
+	rql "github.com/zikes/rql/parse"
+)
+
+// FromSQL parses a SQL boolean expression, such as the condition of a WHERE
+// clause, into an RQL parse tree. It accepts comparisons, IN, BETWEEN, LIKE,
+// ILIKE, IS [NOT] NULL, IS [NOT] TRUE and FALSE, AND, OR and NOT, along with
+// the other SQL written by ToSQL in either dialect: regular expression
+// matches, array operators, quantified comparisons, JSON paths and their
+// casts, scalar functions and arithmetic.
+//
+// RQL has no negation, so NOT is applied to the conditions beneath it, and
+// conditions which cannot be negated, such as NOT LIKE, are rejected, as
+// are comparisons with NULL other than IS NULL. Double-quoted and
+// backquoted identifiers are accepted, and may be qualified, as in
+// "users"."age", which becomes users.age. Single-quoted strings are read as
+// standard SQL, in which backslash is not an escape character, so the
+// backslashes MySQL requires to be doubled are kept doubled.
+func FromSQL(name, text string) (tree *rql.Tree, err error) {
+	p := &sqlParser{name: name, text: text}
+	defer convert.Recover(&err)
+	p.scan()
+	src := ""
+	if p.peek().kind != sqlEOF {
+		src = p.or(false)
+		if tok := p.peek(); tok.kind != sqlEOF {
+			p.unexpected(tok)
+		}
+	}
+	tree, err = rql.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%v in translation %s", err, src)
+	}
+	return tree, nil
+}
+
+// sqlTokenKind identifies the type of a SQL token
+type sqlTokenKind int
+
+const (
+	sqlEOF         sqlTokenKind = iota
+	sqlIdent                    // identifier or keyword
+	sqlQuotedIdent              // identifier with a double-quoted or backquoted part
+	sqlString                   // string literal
+	sqlNumber                   // numeric literal
+	sqlSymbol                   // operator or punctuation
+)
+
+// sqlToken is a token of SQL text
+type sqlToken struct {
+	kind sqlTokenKind
+	val  string // text of the token, unquoted for strings and identifiers
+	pos  int    // byte offset of the token in the text
+	end  int    // byte offset following the token
+}
+
+// sqlSymbols are the operators and punctuation of the accepted SQL, longest
+// first
+var sqlSymbols = []string{
+	"->>", "!~*",
+	"->", "::", "~*", "!~", "<=", ">=", "<>", "!=", "@>", "&&",
+	"=", "<", ">", "(", ")", ",", "+", "-", "*", "/", "%", "~", "[", "]",
+}
+
+// sqlKeywords are the words which cannot be used as bare identifiers
+var sqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true,
+	"BETWEEN": true, "LIKE": true, "ILIKE": true, "REGEXP": true,
+	"ANY": true, "ALL": true, "EXISTS": true, "FROM": true, "ARRAY": true,
+}
+
+// comparisonOps maps SQL comparison operators to RQL operators
+var comparisonOps = map[string]string{
+	"=":  "eq",
+	"!=": "ne",
+	"<>": "ne",
+	"<":  "lt",
+	">":  "gt",
+	"<=": "le",
+	">=": "ge",
+}
+
+// arithmeticFuncs maps infix arithmetic operators to RQL functions
+var arithmeticFuncs = map[string]string{}
+
+func init() {
+	for name, op := range rql.Arithmetic {
+		arithmeticFuncs[op] = name
+	}
+}
+
+// sqlOperand is a translated operand
+type sqlOperand struct {
+	rql     string // RQL text of the operand
+	literal bool   // the operand is a value rather than a column or function
+	array   string // RQL text of the array, for cardinality(array)
+}
+
+// sqlParser translates SQL text into RQL text. Errors are raised by
+// panicking with an *rql.Error, which is recovered by FromSQL.
+type sqlParser struct {
+	name   string
+	text   string
+	tokens []sqlToken
+	next   int // index of the next token
+}
+
+// errorf raises an error at the given byte offset of the text
+func (p *sqlParser) errorf(pos int, format string, args ...interface{}) {
+	panic(convert.ErrorAt(p.name, p.text, pos, fmt.Sprintf(format, args...)))
+}
+
+// unexpected raises an error for an unexpected token
+func (p *sqlParser) unexpected(tok sqlToken) {
+	if tok.kind == sqlEOF {
+		p.errorf(tok.pos, "unexpected end of expression")
+	}
+	p.errorf(tok.pos, "unexpected %s", p.text[tok.pos:tok.end])
+}
+
+// scan splits the text into tokens, ending with an sqlEOF token
+func (p *sqlParser) scan() {
+	for i := 0; ; {
+		for i < len(p.text) && isSQLSpace(p.text[i]) {
+			i++
+		}
+		if i == len(p.text) {
+			p.tokens = append(p.tokens, sqlToken{kind: sqlEOF, pos: i, end: i})
+			return
+		}
+		tok := sqlToken{pos: i}
+		switch c := p.text[i]; {
+		case c == '\'':
+			tok.kind = sqlString
+			i, tok.val = p.scanSingleQuoted(i)
+		case c == '"', c == '`', isSQLIdent(c):
+			i, tok.val, tok.kind = p.scanName(i)
+		case isSQLDigit(c):
+			tok.kind = sqlNumber
+			for i < len(p.text) && isSQLDigit(p.text[i]) {
+				i++
+			}
+			if i+1 < len(p.text) && p.text[i] == '.' && isSQLDigit(p.text[i+1]) {
+				for i++; i < len(p.text) && isSQLDigit(p.text[i]); i++ {
+				}
+			}
+			if i < len(p.text) && (p.text[i] == 'e' || p.text[i] == 'E') {
+				j := i + 1
+				if j < len(p.text) && (p.text[j] == '+' || p.text[j] == '-') {
+					j++
+				}
+				if j < len(p.text) && isSQLDigit(p.text[j]) {
+					for i = j; i < len(p.text) && isSQLDigit(p.text[i]); i++ {
+					}
+				}
+			}
+			if i < len(p.text) && isSQLIdent(p.text[i]) {
+				p.errorf(tok.pos, "bad number syntax: %q", p.text[tok.pos:i+1])
+			}
+			tok.val = p.decimal(tok.pos, p.text[tok.pos:i])
+		default:
+			for _, s := range sqlSymbols {
+				if strings.HasPrefix(p.text[i:], s) {
+					tok.kind = sqlSymbol
+					tok.val = s
+					i += len(s)
+					break
+				}
+			}
+			if tok.kind != sqlSymbol {
+				p.errorf(i, "unrecognized character %q", p.text[i])
+			}
+		}
+		tok.end = i
+		p.tokens = append(p.tokens, tok)
+	}
+}
+
+// scanSingleQuoted scans a SQL string literal starting at i, returning the
+// offset following it and its unquoted text
+func (p *sqlParser) scanSingleQuoted(i int) (int, string) {
+	var b strings.Builder
+	for j := i + 1; j < len(p.text); j++ {
+		if p.text[j] != '\'' {
+			b.WriteByte(p.text[j])
+			continue
+		}
+		if j+1 < len(p.text) && p.text[j+1] == '\'' {
+			b.WriteByte('\'')
+			j++
+			continue
+		}
+		return j + 1, b.String()
+	}
+	p.errorf(i, "unterminated quoted string")
+	return 0, ""
+}
+
+// scanName scans an identifier starting at i, whose dot-separated parts may
+// be bare, double-quoted or backquoted, returning the offset following it,
+// its text with the parts unquoted, and its kind: sqlQuotedIdent if any part
+// was quoted, so that it is never read as a keyword.
+func (p *sqlParser) scanName(i int) (int, string, sqlTokenKind) {
+	var b strings.Builder
+	kind := sqlIdent
+	for {
+		switch c := p.text[i]; c {
+		case '"', '`':
+			j := i + 1
+			for ; j < len(p.text); j++ {
+				if p.text[j] != c {
+					b.WriteByte(p.text[j])
+				} else if j+1 < len(p.text) && p.text[j+1] == c {
+					b.WriteByte(c)
+					j++
+				} else {
+					break
+				}
+			}
+			if j == len(p.text) {
+				p.errorf(i, "unterminated quoted identifier")
+			}
+			i, kind = j+1, sqlQuotedIdent
+		default:
+			j := i
+			for j < len(p.text) && (isSQLIdent(p.text[j]) || isSQLDigit(p.text[j])) {
+				j++
+			}
+			if j == i {
+				p.errorf(i, "unexpected %q in identifier", c)
+			}
+			b.WriteString(p.text[i:j])
+			i = j
+		}
+		if i+1 >= len(p.text) || p.text[i] != '.' {
+			return i, b.String(), kind
+		}
+		b.WriteByte('.')
+		i++
+	}
+}
+
+// decimal returns the text of a number at pos without an exponent, which
+// RQL does not accept, as ToSQL writes large and small floats with one
+func (p *sqlParser) decimal(pos int, num string) string {
+	if !strings.ContainsAny(num, "eE") {
+		return num
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		p.errorf(pos, "bad number syntax: %q", num)
+	}
+	num = strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(num, ".") {
+		num += ".0"
+	}
+	return num
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isSQLDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSQLIdent(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// peek returns the next token without consuming it
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.next]
+}
+
+// advance consumes and returns the next token
+func (p *sqlParser) advance() sqlToken {
+	tok := p.tokens[p.next]
+	if tok.kind != sqlEOF {
+		p.next++
+	}
+	return tok
+}
+
+// isSymbol reports whether the token is the given symbol
+func isSymbol(tok sqlToken, s string) bool {
+	return tok.kind == sqlSymbol && tok.val == s
+}
+
+// isKeyword reports whether the token is the given keyword, in any case
+func isKeyword(tok sqlToken, word string) bool {
+	return tok.kind == sqlIdent && strings.EqualFold(tok.val, word)
+}
+
+// symbol consumes the next token if it is the given symbol
+func (p *sqlParser) symbol(s string) bool {
+	if isSymbol(p.peek(), s) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// keyword consumes the next token if it is the given keyword
+func (p *sqlParser) keyword(word string) bool {
+	if isKeyword(p.peek(), word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// expect consumes the given symbol, raising an error if it is missing
+func (p *sqlParser) expect(s string) {
+	if !p.symbol(s) {
+		p.unexpected(p.peek())
+	}
+}
+
+// expectKeyword consumes the given keyword, raising an error if it is
+// missing
+func (p *sqlParser) expectKeyword(word string) {
+	if !p.keyword(word) {
+		p.unexpected(p.peek())
+	}
+}
+
+// join combines conditions with an RQL logical operator
+func join(op string, conds []string) string {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return op + "(" + strings.Join(conds, ",") + ")"
+}
+
+// or parses conditions joined by OR. When neg is set the negation of the
+// conditions is returned, by De Morgan's laws.
+func (p *sqlParser) or(neg bool) string {
+	conds := []string{p.and(neg)}
+	for p.keyword("OR") {
+		conds = append(conds, p.and(neg))
+	}
+	if neg {
+		return join("and", conds)
+	}
+	return join("or", conds)
+}
+
+// and parses conditions joined by AND
+func (p *sqlParser) and(neg bool) string {
+	conds := []string{p.not(neg)}
+	for p.keyword("AND") {
+		conds = append(conds, p.not(neg))
+	}
+	if neg {
+		return join("or", conds)
+	}
+	return join("and", conds)
+}
+
+// not parses a condition with any number of leading NOTs
+func (p *sqlParser) not(neg bool) string {
+	if p.keyword("NOT") {
+		return p.not(!neg)
+	}
+	return p.predicate(neg)
+}
+
+// predicate parses a single condition or a parenthesized expression
+func (p *sqlParser) predicate(neg bool) string {
+	tok := p.peek()
+	switch {
+	case isSymbol(tok, "("):
+		// the parenthesis may open an operand, as in (price * 1.2) > 100
+		mark := p.next
+		if cond, ok := p.try(func() string { return p.condition(neg) }); ok {
+			return cond
+		}
+		p.next = mark + 1
+		cond := p.or(neg)
+		p.expect(")")
+		return cond
+	case isKeyword(tok, "EXISTS"):
+		p.errorf(tok.pos, "subqueries are not supported")
+	case isKeyword(tok, "REGEXP_LIKE") && isSymbol(p.tokens[p.next+1], "("):
+		p.advance()
+		p.advance()
+		left := p.operand()
+		p.expect(",")
+		pattern := p.stringLiteral()
+		flags := ""
+		if p.symbol(",") {
+			flags = p.stringLiteral()
+		}
+		p.expect(")")
+		return p.match(tok, left, pattern, flags, neg)
+	}
+	return p.condition(neg)
+}
+
+// try runs parse, reporting false and discarding the error if it fails
+func (p *sqlParser) try(parse func() string) (cond string, ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, isErr := e.(*rql.Error); !isErr {
+				panic(e)
+			}
+			ok = false
+		}
+	}()
+	return parse(), true
+}
+
+// condition parses an operand followed by a comparison, or a bare boolean
+// operand
+func (p *sqlParser) condition(neg bool) string {
+	left := p.operand()
+	tok := p.peek()
+	if op, ok := comparisonOps[tok.val]; ok && tok.kind == sqlSymbol {
+		p.advance()
+		if q := p.peek(); isKeyword(q, "ANY") || isKeyword(q, "ALL") {
+			return p.quantified(left, op, neg)
+		}
+		return p.compare(op, left, p.operand(), neg)
+	}
+	switch {
+	case isSymbol(tok, "~"), isSymbol(tok, "~*"):
+		p.advance()
+		pattern, flags := p.stringLiteral(), ""
+		if tok.val == "~*" {
+			flags = "i"
+		}
+		if strings.HasPrefix(pattern, "(?w)") {
+			pattern, flags = pattern[len("(?w)"):], "m"+flags
+		}
+		return p.match(tok, left, pattern, flags, neg)
+	case isSymbol(tok, "!~"), isSymbol(tok, "!~*"):
+		p.errorf(tok.pos, "%s cannot be expressed in RQL", tok.val)
+	case isSymbol(tok, "@>"), isSymbol(tok, "&&"):
+		p.advance()
+		if neg {
+			p.errorf(tok.pos, "NOT %s cannot be expressed in RQL", tok.val)
+		}
+		op := "contains"
+		if tok.val == "&&" {
+			op = "overlaps"
+		}
+		p.expectKeyword("ARRAY")
+		p.expect("[")
+		return op + "(" + left.rql + "," + p.list("]") + ")"
+	case isKeyword(tok, "IS"):
+		p.advance()
+		if p.keyword("NOT") {
+			neg = !neg
+		}
+		return p.is(left, neg)
+	case isKeyword(tok, "NOT"):
+		p.advance()
+		return p.operator(left, !neg)
+	case isKeyword(tok, "IN"), isKeyword(tok, "BETWEEN"), isKeyword(tok, "LIKE"), isKeyword(tok, "ILIKE"), isKeyword(tok, "REGEXP"):
+		return p.operator(left, neg)
+	}
+	if left.literal {
+		p.unexpected(tok)
+	}
+	// a bare boolean column or function
+	return p.compare("eq", left, sqlOperand{rql: "true", literal: true}, neg)
+}
+
+// operator parses the keyword operators which may follow NOT
+func (p *sqlParser) operator(left sqlOperand, neg bool) string {
+	tok := p.advance()
+	switch {
+	case isKeyword(tok, "IN"):
+		p.expect("(")
+		values := p.values(")")
+		if !neg {
+			return "in(" + left.rql + ",(" + strings.Join(values, ",") + "))"
+		}
+		conds := []string{}
+		for _, v := range values {
+			if v == "null" {
+				// x NOT IN (1, NULL) is never true
+				p.errorf(tok.pos, "NOT IN with NULL cannot be expressed in RQL")
+			}
+			conds = append(conds, "ne("+left.rql+","+v+")")
+		}
+		return join("and", conds)
+	case isKeyword(tok, "BETWEEN"):
+		low := p.operand()
+		p.expectKeyword("AND")
+		high := p.operand()
+		if neg {
+			return "or(" + p.compare("lt", left, low, false) + "," + p.compare("gt", left, high, false) + ")"
+		}
+		return "and(" + p.compare("ge", left, low, false) + "," + p.compare("le", left, high, false) + ")"
+	case isKeyword(tok, "LIKE"), isKeyword(tok, "ILIKE"):
+		pattern, flags := likeRegexp(p.stringLiteral()), ""
+		if isKeyword(tok, "ILIKE") {
+			flags = "i"
+		}
+		return p.match(tok, left, pattern, flags, neg)
+	case isKeyword(tok, "REGEXP"):
+		return p.match(tok, left, p.stringLiteral(), "", neg)
+	}
+	p.unexpected(tok)
+	return ""
+}
+
+// is parses the NULL, TRUE or FALSE following IS or IS NOT. SQL's IS NOT
+// TRUE and IS NOT FALSE include NULL, which is tested explicitly.
+func (p *sqlParser) is(left sqlOperand, neg bool) string {
+	tok := p.advance()
+	switch {
+	case isKeyword(tok, "NULL"):
+		if neg {
+			return "ne(" + left.rql + ",null)"
+		}
+		return "eq(" + left.rql + ",null)"
+	case isKeyword(tok, "TRUE"), isKeyword(tok, "FALSE"):
+		val := strings.ToLower(tok.val)
+		if !neg {
+			return "eq(" + left.rql + "," + val + ")"
+		}
+		other := "true"
+		if val == "true" {
+			other = "false"
+		}
+		return "or(eq(" + left.rql + "," + other + "),eq(" + left.rql + ",null))"
+	}
+	p.unexpected(tok)
+	return ""
+}
+
+// compare returns an RQL comparison, with any column moved to the left.
+// RQL compares fields with values, so comparisons of two values, such as
+// 'open' = 'open', are rejected. So are comparisons with NULL, which are
+// never true in SQL, while eq(x,null) in RQL means x IS NULL.
+func (p *sqlParser) compare(op string, left, right sqlOperand, neg bool) string {
+	if left.rql == "null" || right.rql == "null" {
+		p.errorf(p.peek().pos, "comparison with NULL cannot be expressed in RQL, use IS NULL")
+	}
+	if neg {
+		op = convert.Negated[op]
+	}
+	if left.array != "" {
+		if op != "eq" {
+			p.errorf(p.peek().pos, "cardinality can only be compared for equality")
+		}
+		return "size(" + left.array + "," + right.rql + ")"
+	}
+	switch {
+	case left.literal && right.literal:
+		p.errorf(p.peek().pos, "comparison of two values cannot be expressed in RQL")
+	case left.literal:
+		left, right, op = right, left, convert.Swapped[op]
+	}
+	return op + "(" + left.rql + "," + right.rql + ")"
+}
+
+// quantified parses the ANY or ALL of a comparison such as 10 < ANY(scores),
+// which becomes any(scores,gt(_,10))
+func (p *sqlParser) quantified(left sqlOperand, op string, neg bool) string {
+	tok := p.advance()
+	if !left.literal {
+		p.errorf(tok.pos, "%s must be compared with a value", strings.ToUpper(tok.val))
+	}
+	if left.rql == "null" {
+		p.errorf(tok.pos, "comparison with NULL cannot be expressed in RQL, use IS NULL")
+	}
+	p.expect("(")
+	array := p.operand()
+	p.expect(")")
+	quantifier := strings.ToLower(tok.val)
+	op = convert.Swapped[op]
+	if neg {
+		// NOT (x = ANY(a)) is x <> ALL(a)
+		op = convert.Negated[op]
+		if quantifier == "any" {
+			quantifier = "all"
+		} else {
+			quantifier = "any"
+		}
+	}
+	return quantifier + "(" + array.rql + "," + op + "(" + Element + "," + left.rql + "))"
+}
+
+// match returns an RQL match of a regular expression
+func (p *sqlParser) match(tok sqlToken, left sqlOperand, pattern, flags string, neg bool) string {
+	if neg {
+		p.errorf(tok.pos, "NOT %s cannot be expressed in RQL", strings.ToUpper(tok.val))
+	}
+	str := "match(" + left.rql + "," + strconv.Quote(pattern)
+	if flags != "" {
+		str += "," + strconv.Quote(flags)
+	}
+	return str + ")"
+}
+
+// likeRegexp converts a LIKE pattern into the equivalent regular
+// expression, anchored unless the pattern starts or ends with %
+func likeRegexp(like string) string {
+	var b strings.Builder
+	for i := 0; i < len(like); i++ {
+		switch c := like[i]; c {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(like) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(like[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(like[i : i+1]))
+		}
+	}
+	pattern := b.String()
+	prefix, suffix := "^", "$"
+	if strings.HasPrefix(pattern, ".*") {
+		pattern, prefix = pattern[len(".*"):], ""
+	}
+	if strings.HasSuffix(pattern, ".*") {
+		pattern, suffix = pattern[:len(pattern)-len(".*")], ""
+	}
+	return prefix + pattern + suffix
+}
+
+// stringLiteral parses a string, returning its text
+func (p *sqlParser) stringLiteral() string {
+	tok := p.advance()
+	if tok.kind != sqlString {
+		p.errorf(tok.pos, "expected a string")
+	}
+	return tok.val
+}
+
+// values parses a comma-separated list of values up to the closing symbol
+func (p *sqlParser) values(closing string) []string {
+	values := []string{}
+	for {
+		v := p.operand()
+		values = append(values, v.rql)
+		if p.symbol(closing) {
+			return values
+		}
+		p.expect(",")
+	}
+}
+
+// list parses a comma-separated list of values up to the closing symbol as
+// an RQL list
+func (p *sqlParser) list(closing string) string {
+	return "(" + strings.Join(p.values(closing), ",") + ")"
+}
+
+// operand parses a sum
+func (p *sqlParser) operand() sqlOperand {
+	left := p.product()
+	for tok := p.peek(); isSymbol(tok, "+") || isSymbol(tok, "-"); tok = p.peek() {
+		p.advance()
+		left = arithmetic(tok.val, left, p.product())
+	}
+	return left
+}
+
+// product parses a product
+func (p *sqlParser) product() sqlOperand {
+	left := p.factor()
+	for tok := p.peek(); isSymbol(tok, "*") || isSymbol(tok, "/") || isSymbol(tok, "%"); tok = p.peek() {
+		p.advance()
+		left = arithmetic(tok.val, left, p.factor())
+	}
+	return left
+}
+
+// arithmetic returns the RQL function call for an infix operator
+func arithmetic(op string, left, right sqlOperand) sqlOperand {
+	return sqlOperand{rql: arithmeticFuncs[op] + "(" + left.rql + "," + right.rql + ")"}
+}
+
+// factor parses a primary operand followed by any casts. RQL infers types
+// from the compared values, so the casts are dropped.
+func (p *sqlParser) factor() sqlOperand {
+	v := p.primary()
+	for p.symbol("::") {
+		tok := p.advance()
+		if tok.kind != sqlIdent || !sqlCasts[strings.ToUpper(tok.val)] {
+			p.errorf(tok.pos, "unsupported cast to %s", tok.val)
+		}
+	}
+	return v
+}
+
+// sqlCasts are the types accepted in casts, as written by ToSQL for JSONB
+// paths
+var sqlCasts = map[string]bool{
+	"NUMERIC": true, "BOOLEAN": true, "TEXT": true,
+}
+
+// primary parses a literal, identifier, function call or parenthesized
+// operand
+func (p *sqlParser) primary() sqlOperand {
+	tok := p.advance()
+	switch tok.kind {
+	case sqlNumber:
+		return sqlOperand{rql: tok.val, literal: true}
+	case sqlString:
+		return sqlOperand{rql: strconv.Quote(tok.val), literal: true}
+	case sqlQuotedIdent:
+		return p.path(tok, tok.val)
+	case sqlSymbol:
+		switch {
+		case isSymbol(tok, "("):
+			v := p.operand()
+			p.expect(")")
+			return v
+		case isSymbol(tok, "-") && p.peek().kind == sqlNumber:
+			return sqlOperand{rql: "-" + p.advance().val, literal: true}
+		}
+	case sqlIdent:
+		word := strings.ToUpper(tok.val)
+		switch {
+		case word == "TRUE", word == "FALSE", word == "NULL":
+			return sqlOperand{rql: strings.ToLower(word), literal: true}
+		case isSymbol(p.peek(), "("):
+			p.advance()
+			return p.function(tok)
+		case sqlKeywords[word]:
+			p.unexpected(tok)
+		}
+		return p.path(tok, tok.val)
+	}
+	p.unexpected(tok)
+	return sqlOperand{}
+}
+
+// path parses the JSONB -> and ->> operators following a column, which
+// become a dotted identifier
+func (p *sqlParser) path(tok sqlToken, ident string) sqlOperand {
+	for isSymbol(p.peek(), "->") || isSymbol(p.peek(), "->>") {
+		p.advance()
+		ident += "." + p.stringLiteral()
+	}
+	return p.identifier(tok, ident)
+}
+
+// identifier checks that a column name is a valid RQL identifier
+func (p *sqlParser) identifier(tok sqlToken, ident string) sqlOperand {
+	if !convert.ValidIdentifier(ident) {
+		p.errorf(tok.pos, "%q is not a valid RQL identifier", ident)
+	}
+	return sqlOperand{rql: ident}
+}
+
+// sqlFunctions maps the names of SQL functions to RQL functions with a
+// different name
+var sqlFunctions = map[string]string{
+	"CHAR_LENGTH": "length",
+}
+
+// function parses the arguments of a function call following its opening
+// parenthesis
+func (p *sqlParser) function(tok sqlToken) sqlOperand {
+	word := strings.ToUpper(tok.val)
+	switch word {
+	case "EXTRACT":
+		field := p.advance()
+		p.expectKeyword("FROM")
+		v := p.operand()
+		p.expect(")")
+		name := strings.ToLower(field.val)
+		if name != "year" && name != "month" && name != "day" {
+			p.errorf(field.pos, "unsupported EXTRACT field %s", field.val)
+		}
+		return sqlOperand{rql: name + "(" + v.rql + ")"}
+	case "JSON_EXTRACT":
+		col := p.advance()
+		if col.kind != sqlIdent && col.kind != sqlQuotedIdent {
+			p.unexpected(col)
+		}
+		p.expect(",")
+		path := p.stringLiteral()
+		p.expect(")")
+		if !strings.HasPrefix(path, "$.") {
+			p.errorf(col.pos, "unsupported JSON path %q", path)
+		}
+		return p.identifier(col, col.val+"."+path[len("$."):])
+	case "CARDINALITY":
+		v := p.operand()
+		p.expect(")")
+		return sqlOperand{rql: "cardinality(" + v.rql + ")", array: v.rql}
+	}
+	name, ok := sqlFunctions[word]
+	if !ok {
+		name = strings.ToLower(word)
+	}
+	if _, ok := rql.LookupFunction(name); !ok || rql.Arithmetic[name] != "" {
+		p.errorf(tok.pos, "unsupported function %s", tok.val)
+	}
+	args := []string{}
+	if !p.symbol(")") {
+		args = p.values(")")
+	}
+	return sqlOperand{rql: name + "(" + strings.Join(args, ",") + ")"}
+}
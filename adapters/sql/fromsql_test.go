@@ -0,0 +1,177 @@
+package sqladapter
+
+import (
+	"strings"
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+var fromSQLTests = []struct {
+	name   string
+	input  string
+	result string
+}{
+	{"empty", "", ""},
+	{"legacy", `status = 'open' AND (age > 21 OR vip IS TRUE)`, `and(eq(status,"open"),or(gt(age,21),eq(vip,true)))`},
+	{"keywords", `status = 'open' and not deleted`, `and(eq(status,"open"),ne(deleted,true))`},
+	{"flattened", `a = 1 AND b = 2 AND c = 3`, `and(eq(a,1),eq(b,2),eq(c,3))`},
+
+	// comparisons
+	{"not equals", `id <> 12`, `ne(id,12)`},
+	{"swapped", `12 < id`, `gt(id,12)`},
+	{"negative", `balance >= -10.5`, `ge(balance,-10.5)`},
+	{"escaped string", `name = 'O''Brien'`, `eq(name,"O'Brien")`},
+	{"quoted identifier", "`order` = 1", `eq(order,1)`},
+	{"double-quoted identifier", `"status" IN ('a', 'b')`, `in(status,("a","b"))`},
+	{"qualified identifier", `"users"."age" > 21 AND users.name = 'x'`, `and(gt(users.age,21),eq(users.name,"x"))`},
+	{"exponent", `x = 1.0000005e+06`, `eq(x,1000000.5)`},
+	{"negative exponent", `x < 1e-05`, `lt(x,0.00001)`},
+	{"in", `id IN (1, 2, 3)`, `in(id,(1,2,3))`},
+	{"not in", `id NOT IN (1, 2)`, `and(ne(id,1),ne(id,2))`},
+	{"between", `age BETWEEN 18 AND 65`, `and(ge(age,18),le(age,65))`},
+	{"not between", `age NOT BETWEEN 18 AND 65`, `or(lt(age,18),gt(age,65))`},
+	{"is null", `deleted_at IS NULL`, `eq(deleted_at,null)`},
+	{"is not null", `deleted_at IS NOT NULL`, `ne(deleted_at,null)`},
+	{"is not true", `vip IS NOT TRUE`, `or(eq(vip,false),eq(vip,null))`},
+
+	// patterns
+	{"like prefix", `host LIKE 'web%'`, `match(host,"^web")`},
+	{"like contains", `name ILIKE '%50\_off%'`, `match(name,"50_off","i")`},
+	{"like exact", `name LIKE 'b_b.'`, `match(name,"^b.b\\.$")`},
+
+	// negation
+	{"not comparison", `NOT (a = 1 OR b < 2)`, `and(ne(a,1),ge(b,2))`},
+	{"double negation", `NOT NOT a = 1`, `eq(a,1)`},
+	{"not quantified", `NOT 10 < ANY(scores)`, `all(scores,le(_,10))`},
+
+	// operands
+	{"arithmetic", `price * 1.2 + 5 > 100`, `gt(add(mul(price,1.2),5),100)`},
+	{"parenthesized operand", `(price - discount) > 100`, `gt(sub(price,discount),100)`},
+	{"function", `LOWER(email) = 'x@y.com'`, `eq(lower(email),"x@y.com")`},
+	{"cast", `(meta->>'age')::numeric >= 21`, `ge(meta.age,21)`},
+}
+
+func TestFromSQL(t *testing.T) {
+	for _, test := range fromSQLTests {
+		tree, err := FromSQL(test.name, test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := tree.Root.String(); got != test.result {
+			t.Errorf("%s: RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+var fromSQLErrorTests = []struct {
+	name  string
+	input string
+	err   string
+}{
+	{"unterminated", `name = 'bob`, `statement: unterminated:1: unterminated quoted string`},
+	{"missing operand", `a = 1 AND`, `statement: missing operand:1: unexpected end of expression`},
+	{"not like", `name NOT LIKE 'a%'`, `statement: not like:1: NOT LIKE cannot be expressed in RQL`},
+	{"subquery", `EXISTS (SELECT 1)`, `statement: subquery:1: subqueries are not supported`},
+	{"function", `SOUNDEX(name) = 'x'`, `statement: function:1: unsupported function SOUNDEX`},
+	{"line", "a = 1\nAND b = = 2", `statement: line:2: unexpected =`},
+	{"type", `LENGTH(name) = 'x'`, `in translation eq(length(name),"x")`},
+	{"cast", `age::point = 1`, `statement: cast:1: unsupported cast to point`},
+	{"two values", `'open' = 'open'`, `statement: two values:1: comparison of two values cannot be expressed in RQL`},
+	{"equals null", `a = NULL`, `statement: equals null:1: comparison with NULL cannot be expressed in RQL, use IS NULL`},
+	{"not equals null", `a != NULL`, `comparison with NULL cannot be expressed in RQL, use IS NULL`},
+	{"null any", `NULL = ANY(a)`, `comparison with NULL cannot be expressed in RQL, use IS NULL`},
+	{"unterminated identifier", `"status = 1`, `unterminated quoted identifier`},
+	{"bad exponent", `x = 1e`, `bad number syntax: "1e"`},
+	{"two values between", `5 BETWEEN 1 AND 10`, `comparison of two values cannot be expressed in RQL`},
+	{"not in null", `x NOT IN (1, NULL)`, `statement: not in null:1: NOT IN with NULL cannot be expressed in RQL`},
+	{"not not in null", `NOT (x IN (1, NULL))`, `NOT IN with NULL cannot be expressed in RQL`},
+}
+
+func TestFromSQLErrors(t *testing.T) {
+	for _, test := range fromSQLErrorTests {
+		_, err := FromSQL(test.name, test.input)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q got %q", test.name, test.err, err)
+		}
+	}
+}
+
+// TestRoundTrip checks that the SQL written by ToSQL is parsed back into
+// an equivalent tree
+func TestRoundTrip(t *testing.T) {
+	type roundTrip struct {
+		name string
+		tr   *Translator
+		sql  string
+	}
+	tests := []roundTrip{}
+	for _, test := range parseTests {
+		if strings.Contains(test.result, "EXISTS") {
+			continue
+		}
+		tests = append(tests, roundTrip{test.name, DefaultTranslator, test.result})
+	}
+	for _, test := range pathTests {
+		tests = append(tests, roundTrip{test.name, &Translator{Paths: test.paths}, test.result})
+	}
+	for _, test := range dialectTests {
+		if test.dialect == MySQL && strings.Contains(test.result, `\\`) {
+			// FromSQL does not read MySQL's backslash escapes
+			continue
+		}
+		tests = append(tests, roundTrip{test.name, &Translator{Dialect: test.dialect}, test.result})
+	}
+	for _, test := range tests {
+		tree, err := FromSQL(test.name, test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got, err := test.tr.ToSQL(tree.Root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.sql {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s\n\tvia:\n\t\t%s", test.name, test.sql, got, tree.Root)
+		}
+	}
+}
+
+// rqlRoundTrips are RQL inputs which are written by ToSQL and read back by
+// FromSQL unchanged
+var rqlRoundTrips = []string{
+	`eq(x,1000000.5)`,
+	`lt(x,0.00001)`,
+	`ge(x,-0.000125)`,
+	`in(x,(1000000.5,0.00001))`,
+	`eq(id,"test")`,
+}
+
+func TestRQLRoundTrip(t *testing.T) {
+	for _, input := range rqlRoundTrips {
+		stmt, err := rql.New(input).Parse(input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		sql, err := ToSQL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		tree, err := FromSQL(input, sql)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if got := tree.Root.String(); got != input {
+			t.Errorf("%s: RQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s\n\tvia:\n\t\t%s", input, input, got, sql)
+		}
+	}
+}
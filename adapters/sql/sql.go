@@ -3,74 +3,405 @@ package sqladapter
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	rql "github.com/zikes/rql/parse"
 )
 
-func ToSQL(n rql.Node) string {
+// Element is the identifier which refers to the array element itself
+// within the predicate of any or all
+const Element = "_"
+
+// Dialect identifies the flavour of SQL generated by a Translator
+type Dialect int
+
+// Dialect constants
+const (
+	PostgreSQL Dialect = iota
+	MySQL
+)
+
+// Translator converts RQL nodes into SQL text
+type Translator struct {
+	Dialect Dialect          // SQL dialect to generate
+	Paths   rql.PathStrategy // how dotted identifiers are resolved
+
+	scope string // alias of the array element within any/all
+	depth int    // nesting depth of any/all
+}
+
+// OperatorFunc translates a custom operator into SQL. The Translator is
+// passed so that operands may be translated with t.ToSQL.
+type OperatorFunc func(t *Translator, n *rql.OperatorNode) (string, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by ToSQL
+var DefaultTranslator = &Translator{}
+
+// ToSQL converts the node into SQL using the DefaultTranslator
+func ToSQL(n rql.Node) (string, error) {
+	return DefaultTranslator.ToSQL(n)
+}
+
+// ToSQL converts the node into SQL, or "" for an empty statement. Custom
+// operators with no registered SQL translation return an error rather than
+// being left out of the condition.
+func (t *Translator) ToSQL(n rql.Node) (string, error) {
 	switch n := n.(type) {
 	case *rql.StatementNode:
-		return ToSQL(n.Operator)
+		if n.Operator == nil {
+			return "", nil
+		}
+		return t.ToSQL(n.Operator)
 	case *rql.BoolNode:
-		return fmt.Sprintf("%v", n.True)
+		return fmt.Sprintf("%v", n.True), nil
 	case *rql.NullNode:
-		return "NULL"
+		return "NULL", nil
 	case *rql.IdentifierNode:
-		return n.Ident
+		return t.identifier(n), nil
+	case *rql.FunctionNode:
+		return t.function(n)
 	case *rql.StringNode:
-		return n.Quoted
+		return t.quote(n.Text), nil
 	case *rql.NumberNode:
 		switch {
 		case n.IsInt:
-			return fmt.Sprintf("%d", n.Int64)
+			return fmt.Sprintf("%d", n.Int64), nil
 		case n.IsUint:
-			return fmt.Sprintf("%d", n.Uint64)
+			return fmt.Sprintf("%d", n.Uint64), nil
 		case n.IsFloat:
-			return fmt.Sprintf("%g", n.Float64)
+			return fmt.Sprintf("%g", n.Float64), nil
 		}
 	case *rql.ListNode:
-		str := []string{}
-		for _, v := range n.Nodes {
-			str = append(str, ToSQL(v))
+		str, err := t.join(n.Nodes, ", ")
+		if err != nil {
+			return "", err
 		}
-		return "(" + strings.Join(str, ", ") + ")"
+		return "(" + str + ")", nil
 	case *rql.OperatorNode:
-		left := n.Operands.Nodes[0]
-		right := n.Operands.Nodes[1]
-		switch n.Operator {
-		case "eq":
-			if right.Type() == rql.NodeNull {
-				return ToSQL(left) + " IS " + ToSQL(right)
-			}
-			return ToSQL(left) + " = " + ToSQL(right)
-		case "ne":
-			if right.Type() == rql.NodeNull {
-				return ToSQL(left) + " IS NOT " + ToSQL(right)
-			}
-			return ToSQL(left) + " != " + ToSQL(right)
-		case "gt":
-			return ToSQL(left) + " > " + ToSQL(right)
-		case "lt":
-			return ToSQL(left) + " < " + ToSQL(right)
-		case "ge":
-			return ToSQL(left) + " >= " + ToSQL(right)
-		case "le":
-			return ToSQL(left) + " <= " + ToSQL(right)
-		case "in":
-			return ToSQL(left) + " IN " + ToSQL(right)
-		case "and":
-			str := []string{}
-			for _, v := range n.Operands.Nodes {
-				str = append(str, ToSQL(v))
-			}
-			return "(" + strings.Join(str, " AND ") + ")"
-		case "or":
-			str := []string{}
-			for _, v := range n.Operands.Nodes {
-				str = append(str, ToSQL(v))
+		if n == nil {
+			return "", nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, n)
+		}
+		return t.operator(n)
+	}
+	return "", fmt.Errorf("unexpected node %s", n)
+}
+
+// operator renders a built-in operator
+func (t *Translator) operator(n *rql.OperatorNode) (string, error) {
+	switch n.Operator {
+	case "and":
+		str, err := t.join(n.Operands.Nodes, " AND ")
+		if err != nil {
+			return "", err
+		}
+		return "(" + str + ")", nil
+	case "or":
+		str, err := t.join(n.Operands.Nodes, " OR ")
+		if err != nil {
+			return "", err
+		}
+		return "(" + str + ")", nil
+	case "match":
+		return t.match(n)
+	case "in":
+		return t.in(n)
+	}
+	if _, ok := infix[n.Operator]; !ok && !quantifiers[n.Operator] && n.Operator != "size" {
+		return "", fmt.Errorf("operator %s has no SQL translation", n.Operator)
+	}
+	if len(n.Operands.Nodes) != 2 {
+		return "", fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
+	}
+	left, err := t.ToSQL(n.Operands.Nodes[0])
+	if err != nil {
+		return "", err
+	}
+	right := n.Operands.Nodes[1]
+	if quantifiers[n.Operator] {
+		return t.quantifier(n.Operator, left, right)
+	}
+	if _, ok := flipped[n.Operator]; ok {
+		left = t.cast(left, n.Operands.Nodes[0], right)
+	}
+	var str string
+	switch n.Operator {
+	case "contains", "overlaps":
+		str, err = t.array(right)
+	default:
+		str, err = t.ToSQL(right)
+	}
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case n.Operator == "size":
+		return "cardinality(" + left + ") = " + str, nil
+	case n.Operator == "eq" && right.Type() == rql.NodeNull:
+		return left + " IS " + str, nil
+	case n.Operator == "ne" && right.Type() == rql.NodeNull:
+		return left + " IS NOT " + str, nil
+	}
+	return left + " " + infix[n.Operator] + " " + str, nil
+}
+
+// infix maps binary operators to their SQL operator
+var infix = map[string]string{
+	"eq":       "=",
+	"ne":       "!=",
+	"gt":       ">",
+	"lt":       "<",
+	"ge":       ">=",
+	"le":       "<=",
+	"contains": "@>",
+	"overlaps": "&&",
+}
+
+// quantifiers are the operators which apply a predicate to the elements of
+// an array
+var quantifiers = map[string]bool{"any": true, "all": true}
+
+// quantifier renders any or all of the array, whose SQL is left, as a
+// comparison with ANY or ALL where possible, and as a subquery otherwise
+func (t *Translator) quantifier(op, left string, pred rql.Node) (string, error) {
+	quantifier := strings.ToUpper(op)
+	if str, ok, err := t.quantified(pred, quantifier, left); ok || err != nil {
+		return str, err
+	}
+	sub := t.scoped()
+	where, err := sub.ToSQL(pred)
+	if err != nil {
+		return "", err
+	}
+	if op == "any" {
+		return "EXISTS (SELECT 1 FROM unnest(" + left + ") AS " + sub.scope + " WHERE " + where + ")", nil
+	}
+	return "NOT EXISTS (SELECT 1 FROM unnest(" + left + ") AS " + sub.scope + " WHERE NOT (" + where + "))", nil
+}
+
+// in renders membership in a list of values, given either as a single list
+// or as the remaining operands
+func (t *Translator) in(n *rql.OperatorNode) (string, error) {
+	if len(n.Operands.Nodes) < 2 {
+		return "", fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
+	}
+	left, err := t.ToSQL(n.Operands.Nodes[0])
+	if err != nil {
+		return "", err
+	}
+	left = t.cast(left, n.Operands.Nodes[0], n.Operands.Nodes[1])
+	values := n.Operands.Nodes[1:]
+	if list, ok := values[0].(*rql.ListNode); ok && len(values) == 1 {
+		values = list.Nodes
+	}
+	str, err := t.join(values, ", ")
+	if err != nil {
+		return "", err
+	}
+	return left + " IN (" + str + ")", nil
+}
+
+// join renders the nodes separated by sep
+func (t *Translator) join(nodes []rql.Node, sep string) (string, error) {
+	str := []string{}
+	for _, v := range nodes {
+		s, err := t.ToSQL(v)
+		if err != nil {
+			return "", err
+		}
+		str = append(str, s)
+	}
+	return strings.Join(str, sep), nil
+}
+
+// match renders a regular expression match for the Translator's Dialect
+func (t *Translator) match(n *rql.OperatorNode) (string, error) {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return "", err
+	}
+	left, err := t.ToSQL(n.Operands.Nodes[0])
+	if err != nil {
+		return "", err
+	}
+	if t.Dialect == MySQL {
+		if flags == "" {
+			return left + " REGEXP " + t.quote(pattern), nil
+		}
+		return "REGEXP_LIKE(" + left + ", " + t.quote(pattern) + ", " + t.quote(flags) + ")", nil
+	}
+	if strings.Contains(flags, "m") {
+		// newline-sensitive ^ and $, as with Go's (?m)
+		pattern = "(?w)" + pattern
+	}
+	if strings.Contains(flags, "i") {
+		return left + " ~* " + quote(pattern), nil
+	}
+	return left + " ~ " + quote(pattern), nil
+}
+
+// function renders a scalar function call for the Translator's Dialect
+func (t *Translator) function(n *rql.FunctionNode) (string, error) {
+	args := []string{}
+	for _, v := range n.Args.Nodes {
+		s, err := t.ToSQL(v)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, s)
+	}
+	if op, ok := rql.Arithmetic[n.Name]; ok {
+		return "(" + strings.Join(args, " "+op+" ") + ")", nil
+	}
+	name := strings.ToUpper(n.Name)
+	switch n.Name {
+	case "year", "month", "day":
+		if t.Dialect != MySQL {
+			return "EXTRACT(" + name + " FROM " + args[0] + ")", nil
+		}
+	case "length":
+		if t.Dialect == MySQL {
+			// LENGTH counts bytes in MySQL
+			name = "CHAR_LENGTH"
+		}
+	}
+	return name + "(" + strings.Join(args, ", ") + ")", nil
+}
+
+// flipped maps comparison operators to the SQL operator which is
+// equivalent once its operands are swapped
+var flipped = map[string]string{
+	"eq": "=",
+	"ne": "!=",
+	"gt": "<",
+	"lt": ">",
+	"ge": "<=",
+	"le": ">=",
+}
+
+// quantified renders comparisons of the array element itself against a
+// literal, such as any(tags,eq(_,"a")), as `'a' = ANY(tags)`
+func (t *Translator) quantified(n rql.Node, quantifier string, array string) (string, bool, error) {
+	op, ok := n.(*rql.OperatorNode)
+	if !ok || len(op.Operands.Nodes) != 2 || flipped[op.Operator] == "" {
+		return "", false, nil
+	}
+	ident, ok := op.Operands.Nodes[0].(*rql.IdentifierNode)
+	if !ok || ident.Ident != Element {
+		return "", false, nil
+	}
+	switch op.Operands.Nodes[1].Type() {
+	case rql.NodeString, rql.NodeNumber, rql.NodeBool:
+	default:
+		return "", false, nil
+	}
+	value, err := t.ToSQL(op.Operands.Nodes[1])
+	if err != nil {
+		return "", false, err
+	}
+	return value + " " + flipped[op.Operator] + " " + quantifier + "(" + array + ")", true, nil
+}
+
+// scoped returns a copy of the Translator which resolves identifiers
+// against the element of an unnested array
+func (t *Translator) scoped() *Translator {
+	sub := *t
+	sub.depth++
+	sub.scope = "elem"
+	if sub.depth > 1 {
+		sub.scope = fmt.Sprintf("elem%d", sub.depth)
+	}
+	return &sub
+}
+
+// array renders a list of values as an ARRAY constructor
+func (t *Translator) array(n rql.Node) (string, error) {
+	list, ok := n.(*rql.ListNode)
+	if !ok {
+		return t.ToSQL(n)
+	}
+	str, err := t.join(list.Nodes, ", ")
+	if err != nil {
+		return "", err
+	}
+	return "ARRAY[" + str + "]", nil
+}
+
+// cast casts the SQL of a JSONB path to the type of the value it is
+// compared with, as ->> gives text
+func (t *Translator) cast(sql string, left, right rql.Node) string {
+	ident, ok := left.(*rql.IdentifierNode)
+	if !ok || !ident.IsPath() || t.Paths != rql.PathJSONB || t.scope != "" {
+		return sql
+	}
+	if typ := rql.JSONBCast(right); typ != "" {
+		return "(" + sql + ")::" + typ
+	}
+	return sql
+}
+
+// identifier resolves an identifier according to the Translator's PathStrategy
+func (t *Translator) identifier(n *rql.IdentifierNode) string {
+	if t.scope != "" {
+		if n.Ident == Element {
+			return t.scope
+		}
+		return t.scope + "." + n.Ident
+	}
+	if !n.IsPath() {
+		return n.Ident
+	}
+	path := n.Path()
+	switch t.Paths {
+	case rql.PathJSONB:
+		str := path[0]
+		for i, p := range path[1:] {
+			if i == len(path)-2 {
+				str += "->>" + quote(p)
+			} else {
+				str += "->" + quote(p)
 			}
-			return "(" + strings.Join(str, " OR ") + ")"
 		}
+		return str
+	case rql.PathJSONExtract:
+		return "JSON_EXTRACT(" + path[0] + ", " + t.quote("$."+strings.Join(path[1:], ".")) + ")"
+	}
+	return n.Ident
+}
+
+// quote returns s as a single-quoted string literal for the Translator's
+// Dialect. MySQL treats backslash as an escape character within strings,
+// so it is doubled.
+func (t *Translator) quote(s string) string {
+	if t.Dialect == MySQL {
+		s = strings.Replace(s, `\`, `\\`, -1)
 	}
-	return ""
+	return quote(s)
+}
+
+// quote returns s as a single-quoted SQL string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
 }
@@ -0,0 +1,184 @@
+package sqladapter
+
+import (
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+type parseTest struct {
+	name   string
+	input  string
+	result string
+}
+
+var parseTests = []parseTest{
+	{"empty", "", ``},
+	{"nested", "and(eq(id,12),or(lt(age,21),gt(height,156.2)))", `(id = 12 AND (age < 21 OR height > 156.2))`},
+
+	// operators
+	{"equals", "eq(id,12)", `id = 12`},
+	{"not equals", "ne(id,12)", `id != 12`},
+	{"less than", "lt(id,12)", `id < 12`},
+	{"greater than", "gt(id,12)", `id > 12`},
+	{"less than equals", "le(id,12)", `id <= 12`},
+	{"greater than equals", "ge(id,12)", `id >= 12`},
+	{"in", "in(id,(12,13,14))", `id IN (12, 13, 14)`},
+	{"in operands", "in(id,12,13,14)", `id IN (12, 13, 14)`},
+	{"in single", "in(id,12)", `id IN (12)`},
+
+	{"contains", `contains(tags,(1,2))`, `tags @> ARRAY[1, 2]`},
+	{"overlaps", `overlaps(tags,(1,2))`, `tags && ARRAY[1, 2]`},
+	{"size", `size(tags,3)`, `cardinality(tags) = 3`},
+	{"any element", `any(scores,gt(_,10))`, `10 < ANY(scores)`},
+	{"all element", `all(scores,eq(_,10))`, `10 = ALL(scores)`},
+	{"any string element", `any(tags,eq(_,"a"))`, `'a' = ANY(tags)`},
+	{"any", `any(items,gt(price,10))`, `EXISTS (SELECT 1 FROM unnest(items) AS elem WHERE elem.price > 10)`},
+	{"all", `all(items,and(gt(price,10),ne(_,null)))`, `NOT EXISTS (SELECT 1 FROM unnest(items) AS elem WHERE NOT ((elem.price > 10 AND elem IS NOT NULL)))`},
+	{"nested any", `any(orders,any(lines,eq(sku,12)))`, `EXISTS (SELECT 1 FROM unnest(orders) AS elem WHERE EXISTS (SELECT 1 FROM unnest(elem.lines) AS elem2 WHERE elem2.sku = 12))`},
+	{"match", `match(hostname,"^web-[0-9]+$")`, `hostname ~ '^web-[0-9]+$'`},
+	{"match case-insensitive", `match(hostname,"^web","i")`, `hostname ~* '^web'`},
+	{"match multi-line", `match(notes,"^todo","mi")`, `notes ~* '(?w)^todo'`},
+	{"function", `eq(lower(email),"x@y.com")`, `LOWER(email) = 'x@y.com'`},
+	{"nested function", `gt(length(trim(name)),3)`, `LENGTH(TRIM(name)) > 3`},
+	{"extract", `eq(year(created),2024)`, `EXTRACT(YEAR FROM created) = 2024`},
+	{"arithmetic", `gt(mul(price,1.2),100)`, `(price * 1.2) > 100`},
+	{"nested arithmetic", `gt(sub(end,start),add(3000,mod(id,600)))`, `(end - start) > (3000 + (id % 600))`},
+
+	{"null", "eq(id,null)", `id IS NULL`},
+	{"not null", "ne(id,null)", `id IS NOT NULL`},
+	{"bool", "eq(id,true)", `id = true`},
+	{"string", `eq(id,"test")`, `id = 'test'`},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, err := ToSQL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+var pathTests = []struct {
+	name   string
+	paths  rql.PathStrategy
+	input  string
+	result string
+}{
+	{"column", rql.PathColumn, "eq(user.address.city,12)", `user.address.city = 12`},
+	{"jsonb", rql.PathJSONB, "eq(user.address.city,12)", `(user->'address'->>'city')::numeric = 12`},
+	{"jsonb single", rql.PathJSONB, "eq(user.city,12)", `(user->>'city')::numeric = 12`},
+	{"jsonb string", rql.PathJSONB, `eq(user.address.city,"Oslo")`, `user->'address'->>'city' = 'Oslo'`},
+	{"jsonb bool", rql.PathJSONB, "eq(user.active,true)", `(user->>'active')::boolean = true`},
+	{"jsonb null", rql.PathJSONB, "eq(user.city,null)", `user->>'city' IS NULL`},
+	{"jsonb in", rql.PathJSONB, "in(user.age,(21,30))", `(user->>'age')::numeric IN (21, 30)`},
+	{"json_extract", rql.PathJSONExtract, "eq(user.address.city,12)", `JSON_EXTRACT(user, '$.address.city') = 12`},
+	{"document", rql.PathDocument, "eq(user.address.city,12)", `user.address.city = 12`},
+	{"not a path", rql.PathJSONB, "eq(city,12)", `city = 12`},
+}
+
+func TestPaths(t *testing.T) {
+	for _, test := range pathTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, err := (&Translator{Paths: test.paths}).ToSQL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+var dialectTests = []struct {
+	name    string
+	dialect Dialect
+	input   string
+	result  string
+}{
+	{"postgres match", PostgreSQL, `match(hostname,"^web")`, `hostname ~ '^web'`},
+	{"mysql match", MySQL, `match(hostname,"^web")`, `hostname REGEXP '^web'`},
+	{"mysql length", MySQL, `gt(length(name),3)`, `CHAR_LENGTH(name) > 3`},
+	{"mysql year", MySQL, `eq(year(created),2024)`, `YEAR(created) = 2024`},
+	{"mysql match flags", MySQL, `match(hostname,"^web","i")`, `REGEXP_LIKE(hostname, '^web', 'i')`},
+	{"mysql match escape", MySQL, `match(hostname,"web\\.example")`, `hostname REGEXP 'web\\.example'`},
+	{"mysql match quote", MySQL, `match(host,"\\' OR 1=1 #")`, `host REGEXP '\\'' OR 1=1 #'`},
+	{"mysql match flags quote", MySQL, `match(host,"\\'","i")`, `REGEXP_LIKE(host, '\\''', 'i')`},
+	{"postgres match escape", PostgreSQL, `match(hostname,"web\\.example")`, `hostname ~ 'web\.example'`},
+}
+
+func TestDialects(t *testing.T) {
+	for _, test := range dialectTests {
+		stmt, err := rql.New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		got, err := (&Translator{Dialect: test.dialect}).ToSQL(stmt.Root)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.result {
+			t.Errorf("%s: SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s", test.name, test.result, got)
+		}
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "hasRole", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	RegisterOperator("hasRole", func(t *Translator, n *rql.OperatorNode) (string, error) {
+		role, err := t.ToSQL(n.Operands.Nodes[1])
+		if err != nil {
+			return "", err
+		}
+		user, err := t.ToSQL(n.Operands.Nodes[0])
+		if err != nil {
+			return "", err
+		}
+		return role + " = ANY(" + user + ".roles)", nil
+	})
+	stmt, err := rql.New("custom").Parse(`and(hasRole(user,"admin"),eq(id,12))`)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	want := `('admin' = ANY(user.roles) AND id = 12)`
+	if got, err := ToSQL(stmt.Root); err != nil || got != want {
+		t.Errorf("SQL mismatch\n\texpected:\n\t\t%s\n\tgot:\n\t\t%s (%v)", want, got, err)
+	}
+}
+
+func TestUntranslatable(t *testing.T) {
+	err := rql.RegisterOperator(rql.Operator{Name: "near", Operands: []rql.ValueType{rql.TypeAny, rql.TypeString}})
+	if err != nil {
+		t.Fatalf("unexpected registration failure: %v", err)
+	}
+	for _, input := range []string{
+		`near(location,"Oslo")`,
+		`and(eq(a,1),near(location,"Oslo"))`,
+		`any(items,near(location,"Oslo"))`,
+	} {
+		stmt, err := rql.New("untranslatable").Parse(input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		if got, err := ToSQL(stmt.Root); err == nil {
+			t.Errorf("%s: expected an error, got %s", input, got)
+		}
+	}
+}
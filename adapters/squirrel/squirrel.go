@@ -0,0 +1,272 @@
+package squirreladapter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/zikes/rql/adapters/internal/translate"
+	rql "github.com/zikes/rql/parse"
+)
+
+// Translator converts RQL nodes into squirrel expressions
+type Translator struct {
+	Paths rql.PathStrategy // how dotted identifiers are resolved
+}
+
+// OperatorFunc translates a custom operator into a squirrel expression. The
+// Translator is passed so that operands may be translated with t.ToSquirrel.
+type OperatorFunc func(t *Translator, n *rql.OperatorNode) (sq.Sqlizer, error)
+
+var (
+	operatorsMu sync.RWMutex
+	operators   = map[string]OperatorFunc{}
+)
+
+// RegisterOperator sets the translation of a custom operator, which must
+// also be registered with rql.RegisterOperator for it to be parsed.
+func RegisterOperator(name string, fn OperatorFunc) {
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	operators[name] = fn
+}
+
+func lookupOperator(name string) (OperatorFunc, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	fn, ok := operators[name]
+	return fn, ok
+}
+
+// DefaultTranslator is the Translator used by ToSquirrel
+var DefaultTranslator = &Translator{}
+
+// ToSquirrel converts the node into a squirrel expression using the
+// DefaultTranslator
+func ToSquirrel(n rql.Node) (sq.Sqlizer, error) {
+	return DefaultTranslator.ToSquirrel(n)
+}
+
+// comparisons maps comparison operators to SQL
+var comparisons = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"lt": "<",
+	"gt": ">",
+	"le": "<=",
+	"ge": ">=",
+}
+
+// ToSquirrel converts the node into a squirrel expression, to be passed to
+// the Where method of a builder. Empty statements return nil, which Where
+// ignores. Operators with no squirrel translation, such as the array
+// operators, return an error rather than being left out of the filter.
+func (t *Translator) ToSquirrel(n rql.Node) (sq.Sqlizer, error) {
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator == nil {
+			return nil, nil
+		}
+		return t.ToSquirrel(n.Operator)
+	case *rql.OperatorNode:
+		if n == nil {
+			return nil, nil
+		}
+		if fn, ok := lookupOperator(n.Operator); ok {
+			return fn(t, n)
+		}
+		if len(n.Operands.Nodes) == 0 {
+			return nil, fmt.Errorf("operator %s has no operands", n.Operator)
+		}
+		left := n.Operands.Nodes[0]
+		switch n.Operator {
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			if len(n.Operands.Nodes) != 2 {
+				return nil, fmt.Errorf("operator %s expects 2 operands, got %d", n.Operator, len(n.Operands.Nodes))
+			}
+			return t.compare(comparisons[n.Operator], left, n.Operands.Nodes[1]), nil
+		case "in":
+			if len(n.Operands.Nodes) < 2 {
+				return nil, fmt.Errorf("operator in expects at least 2 operands, got %d", len(n.Operands.Nodes))
+			}
+			values := []interface{}{}
+			for _, v := range n.Operands.Nodes[1:] {
+				values = append(values, translate.Value(v))
+			}
+			if len(values) == 1 {
+				if list, ok := values[0].([]interface{}); ok {
+					values = list
+				}
+			}
+			col, args := t.expr(left)
+			col = t.cast(col, left, n.Operands.Nodes[1])
+			if _, ok := left.(*rql.IdentifierNode); ok {
+				return sq.Eq{col: values}, nil
+			}
+			if len(values) == 0 {
+				return sq.Expr("(1=0)"), nil
+			}
+			return sq.Expr(col+" IN ("+sq.Placeholders(len(values))+")", append(args, values...)...), nil
+		case "match":
+			return t.match(n)
+		case "or", "and":
+			parts := []sq.Sqlizer{}
+			for _, v := range n.Operands.Nodes {
+				e, err := t.ToSquirrel(v)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, e)
+			}
+			if n.Operator == "or" {
+				return sq.Or(parts), nil
+			}
+			return sq.And(parts), nil
+		}
+		return nil, fmt.Errorf("operator %s has no squirrel translation", n.Operator)
+	}
+	return nil, fmt.Errorf("unexpected node %s", n)
+}
+
+// compare translates a comparison. Columns compared with literals use the
+// squirrel map types, which turn null into IS NULL and IS NOT NULL.
+func (t *Translator) compare(op string, left, right rql.Node) sq.Sqlizer {
+	col, args := t.expr(left)
+	col = t.cast(col, left, right)
+	if _, ok := left.(*rql.IdentifierNode); ok && translate.IsLiteral(right) {
+		v := translate.Value(right)
+		switch op {
+		case "=":
+			return sq.Eq{col: v}
+		case "<>":
+			return sq.NotEq{col: v}
+		case "<":
+			return sq.Lt{col: v}
+		case ">":
+			return sq.Gt{col: v}
+		case "<=":
+			return sq.LtOrEq{col: v}
+		case ">=":
+			return sq.GtOrEq{col: v}
+		}
+	}
+	if _, ok := right.(*rql.NullNode); ok {
+		switch op {
+		case "=":
+			return sq.Expr(col+" IS NULL", args...)
+		case "<>":
+			return sq.Expr(col+" IS NOT NULL", args...)
+		}
+	}
+	rcol, rargs := t.expr(right)
+	return sq.Expr(col+" "+op+" "+rcol, append(args, rargs...)...)
+}
+
+// match translates a regular expression match for PostgreSQL. Patterns
+// which are only anchored literal text become LIKE, or ILIKE with the i
+// flag, and other patterns use the ~ and ~* operators. ILIKE, ~ and ~* are
+// specific to PostgreSQL, so other databases can only match case-sensitive
+// literal patterns.
+func (t *Translator) match(n *rql.OperatorNode) (sq.Sqlizer, error) {
+	pattern, flags, err := rql.MatchPattern(n)
+	if err != nil {
+		return nil, err
+	}
+	left := n.Operands.Nodes[0]
+	col, args := t.expr(left)
+	if like, ok := translate.LikePattern(pattern, flags); ok {
+		if _, ident := left.(*rql.IdentifierNode); ident {
+			if strings.Contains(flags, "i") {
+				return sq.ILike{col: like}, nil
+			}
+			return sq.Like{col: like}, nil
+		}
+		op := " LIKE ?"
+		if strings.Contains(flags, "i") {
+			op = " ILIKE ?"
+		}
+		return sq.Expr(col+op, append(args, like)...), nil
+	}
+	op := " ~ ?"
+	if strings.Contains(flags, "i") {
+		op = " ~* ?"
+	}
+	if strings.Contains(flags, "m") {
+		pattern = "(?w)" + pattern
+	}
+	return sq.Expr(col+op, append(args, pattern)...), nil
+}
+
+// expr renders an operand as SQL with its arguments: identifiers as columns
+// resolved according to the Translator's PathStrategy, function calls as SQL
+// functions, and literals as placeholders.
+func (t *Translator) expr(n rql.Node) (string, []interface{}) {
+	switch n := n.(type) {
+	case *rql.IdentifierNode:
+		return t.column(n), nil
+	case *rql.FunctionNode:
+		return t.function(n)
+	}
+	return "?", []interface{}{translate.Value(n)}
+}
+
+// cast casts the SQL of a JSONB path to the type of the value it is
+// compared with, as ->> gives text
+func (t *Translator) cast(col string, left, right rql.Node) string {
+	ident, ok := left.(*rql.IdentifierNode)
+	if !ok || !ident.IsPath() || t.Paths != rql.PathJSONB {
+		return col
+	}
+	if typ := rql.JSONBCast(right); typ != "" {
+		return "(" + col + ")::" + typ
+	}
+	return col
+}
+
+// column resolves an identifier according to the Translator's PathStrategy
+func (t *Translator) column(ident *rql.IdentifierNode) string {
+	if !ident.IsPath() {
+		return ident.Ident
+	}
+	path := ident.Path()
+	switch t.Paths {
+	case rql.PathJSONB:
+		sql := path[0]
+		for i, p := range path[1:] {
+			if i == len(path)-2 {
+				sql += "->>" + quote(p)
+			} else {
+				sql += "->" + quote(p)
+			}
+		}
+		return sql
+	case rql.PathJSONExtract:
+		return "JSON_EXTRACT(" + path[0] + ", " + quote("$."+strings.Join(path[1:], ".")) + ")"
+	}
+	return ident.Ident
+}
+
+// function converts a scalar function call into SQL
+func (t *Translator) function(n *rql.FunctionNode) (string, []interface{}) {
+	sqls := []string{}
+	args := []interface{}{}
+	for _, v := range n.Args.Nodes {
+		sql, a := t.expr(v)
+		sqls = append(sqls, sql)
+		args = append(args, a...)
+	}
+	if op, ok := rql.Arithmetic[n.Name]; ok {
+		return "(" + strings.Join(sqls, " "+op+" ") + ")", args
+	}
+	switch n.Name {
+	case "year", "month", "day":
+		return "EXTRACT(" + strings.ToUpper(n.Name) + " FROM " + strings.Join(sqls, ", ") + ")", args
+	}
+	return strings.ToUpper(n.Name) + "(" + strings.Join(sqls, ", ") + ")", args
+}
+
+// quote returns s as a single-quoted SQL string
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	rql "github.com/zikes/rql/parse"
+)
+
+func newASTCommand(file *string) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "ast [string to parse]",
+		Short: "Prints the parse tree of RQL",
+		Long: `ast parses RQL from an argument, a file or standard input, and prints the
+resulting tree as indented text, or as JSON with --json.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := parseInput(*file, args)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(astJSON(t.Root))
+			}
+			dumpAST(os.Stdout, t.Root, 0)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the tree as JSON")
+	return cmd
+}
+
+// dumpAST writes the tree rooted at n as indented text, one node per line
+func dumpAST(w io.Writer, n rql.Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		fmt.Fprintf(w, "%sstatement\n", indent)
+		if n.Operator != nil {
+			dumpAST(w, n.Operator, depth+1)
+		}
+	case *rql.OperatorNode:
+		fmt.Fprintf(w, "%soperator %s\n", indent, n.Operator)
+		for _, v := range n.Operands.Nodes {
+			dumpAST(w, v, depth+1)
+		}
+	case *rql.FunctionNode:
+		fmt.Fprintf(w, "%sfunction %s\n", indent, n.Name)
+		for _, v := range n.Args.Nodes {
+			dumpAST(w, v, depth+1)
+		}
+	case *rql.ListNode:
+		fmt.Fprintf(w, "%slist\n", indent)
+		for _, v := range n.Nodes {
+			dumpAST(w, v, depth+1)
+		}
+	default:
+		fmt.Fprintf(w, "%s%s %s\n", indent, n.Type(), n)
+	}
+}
+
+// astNode is the JSON representation of a node
+type astNode struct {
+	Type     string        `json:"type"`
+	Pos      int           `json:"pos"`
+	Value    interface{}   `json:"value,omitempty"`
+	Operator string        `json:"operator,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Operands []interface{} `json:"operands,omitempty"`
+}
+
+// astJSON converts the tree rooted at n into values for encoding as JSON
+func astJSON(n rql.Node) interface{} {
+	a := &astNode{Type: n.Type().String(), Pos: int(n.Position())}
+	switch n := n.(type) {
+	case *rql.StatementNode:
+		if n.Operator != nil {
+			a.Operands = []interface{}{astJSON(n.Operator)}
+		}
+	case *rql.OperatorNode:
+		a.Operator = n.Operator
+		a.Operands = astList(n.Operands)
+	case *rql.FunctionNode:
+		a.Name = n.Name
+		a.Operands = astList(n.Args)
+	case *rql.ListNode:
+		a.Operands = astList(n)
+	case *rql.IdentifierNode:
+		a.Value = n.Ident
+	case *rql.StringNode:
+		a.Value = n.Text
+	case *rql.BoolNode:
+		a.Value = n.True
+	case *rql.NumberNode:
+		// the parsed value, as the text may not be a JSON number, as in .5
+		switch {
+		case n.IsInt:
+			a.Value = n.Int64
+		case n.IsUint:
+			a.Value = n.Uint64
+		default:
+			a.Value = n.Float64
+		}
+	}
+	return a
+}
+
+func astList(l *rql.ListNode) []interface{} {
+	nodes := []interface{}{}
+	for _, v := range l.Nodes {
+		nodes = append(nodes, astJSON(v))
+	}
+	return nodes
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+var astJSONTests = []struct {
+	input string
+	value string // JSON of the number operand
+}{
+	{"eq(a,12)", "12"},
+	{"eq(a,.5)", "0.5"},
+	{"eq(a,+2)", "2"},
+	{"eq(a,-2.25)", "-2.25"},
+	{"eq(a,18446744073709551615)", "18446744073709551615"},
+}
+
+func TestASTJSON(t *testing.T) {
+	for _, test := range astJSONTests {
+		tree, err := rql.Parse(test.input, test.input)
+		if err != nil {
+			t.Fatalf("unexpected parse failure: %v", err)
+		}
+		op := tree.Root.Operator
+		b, err := json.Marshal(astJSON(op.Operands.Nodes[1]))
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		var got struct{ Value json.RawMessage }
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Value) != test.value {
+			t.Errorf("%s: expected value %s got %s", test.input, test.value, got.Value)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	celadapter "github.com/zikes/rql/adapters/cel"
+	rql "github.com/zikes/rql/parse"
+)
+
+func newCELCommand(file *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cel [string to parse]",
+		Short: "Converts RQL to a CEL expression",
+		Long: `cel converts RQL from an argument, a file or standard input into a Common
+Expression Language (CEL) expression.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := parseInput(*file, args)
+			if err != nil {
+				return err
+			}
+			expr, err := celadapter.ToCEL(t.Root)
+			if err != nil {
+				return err
+			}
+			fmt.Println(expr)
+			return nil
+		},
+	}
+}
+
+func newFromCELCommand(file *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "from-cel [expression to convert]",
+		Short: "Converts a CEL expression to RQL",
+		Long: `from-cel converts a CEL expression from an argument, a file or standard
+input into formatted RQL.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, text, err := readQuery(*file, args)
+			if err != nil {
+				return err
+			}
+			t, err := celadapter.FromCEL(name, text)
+			if err != nil {
+				return err
+			}
+			fmt.Print(rql.DefaultPrinter.Format(t))
+			return nil
+		},
+	}
+}
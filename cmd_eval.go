@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	memoryadapter "github.com/zikes/rql/adapters/memory"
+)
+
+func newEvalCommand(file *string) *cobra.Command {
+	var data, format string
+	cmd := &cobra.Command{
+		Use:   "eval [filter]",
+		Short: "Filters JSON, NDJSON or CSV records with RQL",
+		Long: `eval applies an RQL filter to each record read from --data, or standard
+input, and writes the matching records in the same format. The format is
+taken from --format, the data file's extension, or the first character of
+the input. CSV columns whose values are all decimal numbers or all booleans are
+compared as such, and empty CSV values are null.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if *file == "-" && data == "" {
+				return fmt.Errorf("cannot read both the filter and the data from standard input")
+			}
+			t, err := parseInput(*file, args)
+			if err != nil {
+				return err
+			}
+			filter, err := memoryadapter.NewFilter(t.Root)
+			if err != nil {
+				return err
+			}
+			input := data
+			if input == "" {
+				input = "-"
+			}
+			src, err := readInput(input)
+			if err != nil {
+				return err
+			}
+			if format == "" {
+				format = detectFormat(data, src)
+			}
+			out := bufio.NewWriter(os.Stdout)
+			defer out.Flush()
+			switch format {
+			case "json":
+				return evalJSON(filter, src, out)
+			case "ndjson":
+				return evalNDJSON(filter, src, out)
+			case "csv":
+				return evalCSV(filter, src, out)
+			}
+			return fmt.Errorf("unknown format %q", format)
+		},
+	}
+	cmd.Flags().StringVarP(&data, "data", "d", "", "read records from the named file instead of standard input")
+	cmd.Flags().StringVar(&format, "format", "", "format of the records: json, ndjson or csv")
+	return cmd
+}
+
+// detectFormat guesses the format of the records from the file's extension,
+// or failing that from the first character of its contents
+func detectFormat(filename string, src []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return "json"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".csv":
+		return "csv"
+	}
+	switch trimmed := bytes.TrimSpace(src); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return "json"
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return "ndjson"
+	}
+	return "csv"
+}
+
+// decodeRecord decodes a JSON object for filtering
+func decodeRecord(raw []byte) (memoryadapter.Record, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	r := memoryadapter.Record{}
+	return r, dec.Decode(&r)
+}
+
+// evalJSON filters a JSON array of objects, writing the matching objects
+// unchanged as a JSON array
+func evalJSON(filter *memoryadapter.Filter, src []byte, out io.Writer) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(src, &raws); err != nil {
+		return err
+	}
+	fmt.Fprint(out, "[")
+	n := 0
+	for i, raw := range raws {
+		r, err := decodeRecord(raw)
+		if err != nil {
+			return fmt.Errorf("record %d: %s", i+1, err)
+		}
+		ok, err := filter.Match(r)
+		if err != nil {
+			return fmt.Errorf("record %d: %s", i+1, err)
+		}
+		if !ok {
+			continue
+		}
+		if n > 0 {
+			fmt.Fprint(out, ",")
+		}
+		fmt.Fprintf(out, "\n  %s", raw)
+		n++
+	}
+	if n > 0 {
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintln(out, "]")
+	return nil
+}
+
+// evalNDJSON filters newline-delimited JSON objects, writing the matching
+// lines unchanged
+func evalNDJSON(filter *memoryadapter.Filter, src []byte, out io.Writer) error {
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		r, err := decodeRecord(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", i+1, err)
+		}
+		ok, err := filter.Match(r)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", i+1, err)
+		}
+		if ok {
+			fmt.Fprintf(out, "%s\n", bytes.TrimRight(line, "\r"))
+		}
+	}
+	return nil
+}
+
+// evalCSV filters CSV rows, whose first row names the columns, writing the
+// header and the matching rows
+func evalCSV(filter *memoryadapter.Filter, src []byte, out io.Writer) error {
+	rows, err := csv.NewReader(bytes.NewReader(src)).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	header, rows := rows[0], rows[1:]
+	types := inferColumns(len(header), rows)
+	w := csv.NewWriter(out)
+	w.Write(header)
+	for i, row := range rows {
+		r := memoryadapter.Record{}
+		for c, name := range header {
+			if c < len(row) {
+				r[name] = csvValue(row[c], types[c])
+			}
+		}
+		ok, err := filter.Match(r)
+		if err != nil {
+			return fmt.Errorf("row %d: %s", i+2, err)
+		}
+		if ok {
+			w.Write(row)
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvType is the type inferred for a CSV column
+type csvType int
+
+const (
+	csvString csvType = iota
+	csvNumber
+	csvBool
+)
+
+// inferColumns returns the type of each column: number or boolean if every
+// non-empty value in it parses as one, and string otherwise
+func inferColumns(n int, rows [][]string) []csvType {
+	types := make([]csvType, n)
+	for c := range types {
+		numbers, bools, empty := true, true, true
+		for _, row := range rows {
+			if c >= len(row) || row[c] == "" {
+				continue
+			}
+			empty = false
+			if _, ok := parseDecimal(row[c]); !ok {
+				numbers = false
+			}
+			if _, err := strconv.ParseBool(row[c]); err != nil {
+				bools = false
+			}
+		}
+		switch {
+		case empty:
+		case numbers:
+			types[c] = csvNumber
+		case bools:
+			types[c] = csvBool
+		}
+	}
+	return types
+}
+
+// csvValue converts a CSV value to the column's type; empty values are null
+func csvValue(s string, typ csvType) interface{} {
+	if s == "" {
+		return nil
+	}
+	switch typ {
+	case csvNumber:
+		f, _ := parseDecimal(s)
+		return f
+	case csvBool:
+		b, _ := strconv.ParseBool(s)
+		return b
+	}
+	return s
+}
+
+// decimal matches a decimal number, unlike strconv.ParseFloat which also
+// accepts hexadecimal, NaN and infinities
+var decimal = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// parseDecimal parses a finite decimal number
+func parseDecimal(s string) (float64, bool) {
+	if !decimal.MatchString(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
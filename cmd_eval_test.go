@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+var inferTests = []struct {
+	name   string
+	values []string
+	typ    csvType
+}{
+	{"integers", []string{"1", "-2", ""}, csvNumber},
+	{"decimals", []string{".5", "2.", "+1e3", "6.02E23"}, csvNumber},
+	{"booleans", []string{"true", "False", ""}, csvBool},
+	{"strings", []string{"1", "x"}, csvString},
+	{"nan", []string{"1", "nan"}, csvString},
+	{"inf", []string{"inf", "-Infinity"}, csvString},
+	{"hexadecimal", []string{"0x1p-2"}, csvString},
+	{"out of range", []string{"1e400"}, csvString},
+	{"underscores", []string{"1_000"}, csvString},
+}
+
+func TestInferColumns(t *testing.T) {
+	for _, test := range inferTests {
+		rows := [][]string{}
+		for _, v := range test.values {
+			rows = append(rows, []string{v})
+		}
+		if got := inferColumns(1, rows); got[0] != test.typ {
+			t.Errorf("%s: expected type %d got %d", test.name, test.typ, got[0])
+		}
+	}
+}
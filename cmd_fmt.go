@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	rql "github.com/zikes/rql/parse"
+)
+
+func newFmtCommand() *cobra.Command {
+	printer := *rql.DefaultPrinter
+	var write, list, check bool
+	cmd := &cobra.Command{
+		Use:   "fmt [files to format]",
+		Short: "Formats RQL",
+		Long: `fmt formats RQL files, or standard input when no files are given.
+By default the formatted RQL is written to standard output.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				if write {
+					return errors.New("cannot use -w with standard input")
+				}
+				args = []string{"-"}
+			}
+			unformatted := false
+			for _, filename := range args {
+				changed, err := formatFile(&printer, filename, write, list || check)
+				if err != nil {
+					return err
+				}
+				unformatted = unformatted || changed
+			}
+			if check && unformatted {
+				return errors.New("some files are not formatted")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&write, "write", "w", false, "write result to source file instead of standard output")
+	cmd.Flags().BoolVarP(&list, "list", "l", false, "list files whose formatting differs")
+	cmd.Flags().BoolVar(&check, "check", false, "list files whose formatting differs and exit non-zero if there are any")
+	cmd.Flags().StringVar(&printer.Indent, "indent", printer.Indent, "indentation for each nesting level")
+	cmd.Flags().IntVar(&printer.MaxWidth, "width", printer.MaxWidth, "maximum line width, 0 for no limit")
+	cmd.Flags().BoolVar(&printer.BreakLogical, "break-logical", printer.BreakLogical, "print each operand of and/or on its own line")
+	cmd.Flags().BoolVar(&printer.Compact, "compact", printer.Compact, "omit the space after commas")
+	return cmd
+}
+
+// formatFile formats a single file, or standard input if filename is "-",
+// reporting whether its formatting changed.
+func formatFile(printer *rql.Printer, filename string, write, list bool) (bool, error) {
+	src, err := readInput(filename)
+	if err != nil {
+		return false, err
+	}
+	tree := rql.New(filename)
+	tree.Mode = rql.ParseComments
+	if _, err := tree.Parse(string(src)); err != nil {
+		return false, err
+	}
+	res := []byte(printer.Format(tree))
+	changed := !bytes.Equal(src, res)
+	switch {
+	case list:
+		if changed {
+			fmt.Println(filename)
+		}
+	case write:
+		if changed {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return changed, err
+			}
+			return changed, ioutil.WriteFile(filename, res, info.Mode().Perm())
+		}
+	default:
+		os.Stdout.Write(res)
+	}
+	return changed, nil
+}
+
+// readInput reads the named file, or standard input if filename is "-"
+func readInput(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(filename)
+}
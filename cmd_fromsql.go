@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	sqladapter "github.com/zikes/rql/adapters/sql"
+	rql "github.com/zikes/rql/parse"
+)
+
+func newFromSQLCommand(file *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "from-sql [SQL to convert]",
+		Short: "Converts a SQL WHERE condition to RQL",
+		Long: `from-sql converts a SQL boolean expression, such as the condition of a
+WHERE clause, from an argument, a file or standard input into formatted RQL.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, text, err := readQuery(*file, args)
+			if err != nil {
+				return err
+			}
+			t, err := sqladapter.FromSQL(name, text)
+			if err != nil {
+				return err
+			}
+			fmt.Print(rql.DefaultPrinter.Format(t))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zikes/rql/lsp"
+	rql "github.com/zikes/rql/parse"
+)
+
+func newLSPCommand() *cobra.Command {
+	var schema string
+	cmd := &cobra.Command{
+		Use:   "lsp",
+		Short: "Runs a language server on standard input and output",
+		Long: `lsp speaks the Language Server Protocol over standard input and output,
+giving editors diagnostics, completion of operators, functions and schema
+fields, hover documentation and formatting for RQL documents.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s := lsp.NewServer(os.Stdin, os.Stdout)
+			if schema != "" {
+				f, err := os.Open(schema)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				if s.Schema, err = rql.LoadSchema(f); err != nil {
+					return err
+				}
+			}
+			return s.Serve()
+		},
+	}
+	cmd.Flags().StringVar(&schema, "schema", "", "validate documents against, and complete fields from, a JSON schema file")
+	return cmd
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	odataadapter "github.com/zikes/rql/adapters/odata"
+	rql "github.com/zikes/rql/parse"
+)
+
+func newODataCommand(file *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "odata [string to parse]",
+		Short: "Converts RQL to an OData $filter",
+		Long: `odata converts RQL from an argument, a file or standard input into an
+OData $filter expression.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := parseInput(*file, args)
+			if err != nil {
+				return err
+			}
+			filter, err := odataadapter.ToOData(t.Root)
+			if err != nil {
+				return err
+			}
+			fmt.Println(filter)
+			return nil
+		},
+	}
+}
+
+func newFromODataCommand(file *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "from-odata [$filter to convert]",
+		Short: "Converts an OData $filter to RQL",
+		Long: `from-odata converts an OData $filter expression from an argument, a file
+or standard input into formatted RQL.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, text, err := readQuery(*file, args)
+			if err != nil {
+				return err
+			}
+			t, err := odataadapter.FromOData(name, text)
+			if err != nil {
+				return err
+			}
+			fmt.Print(rql.DefaultPrinter.Format(t))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	goquadapter "github.com/zikes/rql/adapters/goqu"
+	sqladapter "github.com/zikes/rql/adapters/sql"
+	rql "github.com/zikes/rql/parse"
+)
+
+const replHelp = `Enter an RQL query to see its tree, normalized form and translation.
+Commands:
+  :adapter sql|goqu       select the adapter used for translation
+  :dialect postgres|mysql select the SQL dialect of the sql adapter
+  :paths <strategy>       select how dotted identifiers are resolved
+  :table <name>           select the table of the goqu adapter's statement
+  :schema <file>          validate queries against a JSON schema file
+  :history                list previous queries
+  !<n>                    run query n from the history again
+  :help                   show this help
+  :quit                   exit
+`
+
+func newREPLCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "repl",
+		Short: "Explores RQL queries interactively",
+		Long: `repl reads RQL queries line by line, printing the parsed tree, the
+normalized form and the output of the selected adapter. Type :help for
+the available commands.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			newREPL(os.Stdin, os.Stdout).run()
+		},
+	}
+}
+
+// repl holds the state of an interactive session
+type repl struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	adapter string
+	sql     *sqladapter.Translator
+	goqu    *goquadapter.Translator
+	table   string
+	schema  *rql.Schema
+	history []string
+}
+
+func newREPL(in io.Reader, out io.Writer) *repl {
+	return &repl{
+		in:      bufio.NewScanner(in),
+		out:     out,
+		adapter: "sql",
+		sql:     &sqladapter.Translator{},
+		goqu:    &goquadapter.Translator{},
+		table:   "test",
+	}
+}
+
+// run reads and evaluates lines until the input ends or :quit is entered
+func (r *repl) run() {
+	for {
+		fmt.Fprint(r.out, "rql> ")
+		if !r.in.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+		raw := r.in.Text()
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "":
+		case line == ":quit", line == ":q":
+			return
+		case strings.HasPrefix(line, ":"):
+			r.command(strings.Fields(line[1:]))
+		case strings.HasPrefix(line, "!"):
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(r.history) {
+				fmt.Fprintf(r.out, "no query %s in history\n", line[1:])
+				break
+			}
+			fmt.Fprintln(r.out, r.history[n-1])
+			r.eval("", r.history[n-1])
+		default:
+			indent := raw[:len(raw)-len(strings.TrimLeftFunc(raw, unicode.IsSpace))]
+			r.eval("rql> "+indent, line)
+		}
+	}
+}
+
+// command runs a : command with its arguments
+func (r *repl) command(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(r.out, replHelp)
+		return
+	}
+	arg := ""
+	if len(args) > 1 {
+		arg = args[1]
+	}
+	switch args[0] {
+	case "adapter":
+		switch arg {
+		case "sql", "goqu":
+			r.adapter = arg
+		default:
+			fmt.Fprintln(r.out, "adapter must be sql or goqu")
+		}
+	case "dialect":
+		switch arg {
+		case "postgres":
+			r.sql.Dialect = sqladapter.PostgreSQL
+			r.goqu.Dialect = arg
+		case "mysql":
+			r.sql.Dialect = sqladapter.MySQL
+			r.goqu.Dialect = arg
+		default:
+			fmt.Fprintln(r.out, "dialect must be postgres or mysql")
+		}
+	case "paths":
+		p, ok := rql.ParsePathStrategy(arg)
+		if !ok {
+			fmt.Fprintln(r.out, "paths must be column, jsonb, json_extract or document")
+			break
+		}
+		r.sql.Paths = p
+		r.goqu.Paths = p
+	case "table":
+		if arg == "" {
+			fmt.Fprintln(r.out, "table must be named")
+			break
+		}
+		r.table = arg
+	case "schema":
+		f, err := os.Open(arg)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		defer f.Close()
+		schema, err := rql.LoadSchema(f)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		r.schema = schema
+		fmt.Fprintf(r.out, "loaded %d fields\n", len(schema.Fields))
+	case "history":
+		for i, q := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, q)
+		}
+	case "help":
+		fmt.Fprint(r.out, replHelp)
+	default:
+		fmt.Fprintf(r.out, "unknown command :%s, type :help for help\n", args[0])
+	}
+}
+
+// eval parses a query and prints its tree, normalized form and translation.
+// The query is shown on the terminal after prefix, so that a parse error can
+// be marked beneath it.
+func (r *repl) eval(prefix, query string) {
+	r.history = append(r.history, query)
+	t, err := rql.New("repl").Parse(query)
+	if err != nil {
+		if e, ok := err.(*rql.Error); ok {
+			fmt.Fprintln(r.out, caret(prefix, query, int(e.Pos)))
+		}
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	fmt.Fprintln(r.out, "tree:")
+	dumpAST(r.out, t.Root, 1)
+	fmt.Fprint(r.out, "normalized:\n  ", (&rql.Printer{}).Format(t))
+	if r.schema != nil {
+		for _, e := range r.schema.Validate(t) {
+			fmt.Fprintf(r.out, "schema: %d:%d: %s\n", e.Line, e.Column, e.Msg)
+		}
+	}
+	switch r.adapter {
+	case "goqu":
+		sql, _, err := r.goqu.ToSQL(t.Root, r.table)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		fmt.Fprintf(r.out, "goqu:\n  %s\n", sql)
+	default:
+		sql, err := r.sql.ToSQL(t.Root)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		fmt.Fprintf(r.out, "sql:\n  %s\n", sql)
+	}
+}
+
+// caret returns a line with a ^ beneath the byte offset pos of text, which is
+// shown after prefix. Tabs are kept so that the ^ lines up however they are
+// displayed.
+func caret(prefix, text string, pos int) string {
+	if pos > len(text) {
+		pos = len(text)
+	}
+	pad := []rune{}
+	for _, c := range prefix + text[:pos] {
+		if c != '\t' {
+			c = ' '
+		}
+		pad = append(pad, c)
+	}
+	return string(pad) + "^"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var replCaretTests = []struct {
+	name  string
+	input string
+	caret string // the line marking the last error, beneath "rql> " and the input
+}{
+	{"typed", "eq(a 1)", "          ^"},
+	{"indented", "  eq(a 1)", "            ^"},
+	{"tab", "\teq(a 1)", "     \t     ^"},
+	{"multibyte", `eq(a,"é" 1)`, "              ^"},
+	{"history", "eq(a 1)\n!1", "     ^"}, // beneath the query echoed without a prompt
+}
+
+func TestREPLCaret(t *testing.T) {
+	for _, test := range replCaretTests {
+		out := new(bytes.Buffer)
+		newREPL(strings.NewReader(test.input+"\n"), out).run()
+		lines := strings.Split(out.String(), "\n")
+		caret := ""
+		for i, line := range lines {
+			if strings.HasPrefix(line, "statement:") && i > 0 {
+				caret = lines[i-1]
+			}
+		}
+		// the input is not echoed, so the caret follows the prompt
+		caret = strings.TrimPrefix(caret, "rql> ")
+		if caret != test.caret {
+			t.Errorf("%s: expected caret line %q got %q", test.name, test.caret, caret)
+		}
+	}
+}
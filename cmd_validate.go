@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	rql "github.com/zikes/rql/parse"
+)
+
+// diagnostic is the JSON representation of a parse error
+type diagnostic struct {
+	Name    string `json:"name"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
+	Message string `json:"message"`
+}
+
+func newValidateCommand(file *string) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "validate [string to validate]",
+		Short: "Checks RQL for errors",
+		Long: `validate parses RQL from an argument, a file or standard input, and exits
+with a non-zero status if it is invalid, describing each problem as
+name:line:column: message, or as a line of JSON with --json.`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, text, err := readQuery(*file, args)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return err
+			}
+			t := rql.New(name)
+			t.Mode = rql.RecoverErrors
+			_, err = t.Parse(text)
+			var list rql.ErrorList
+			switch e := err.(type) {
+			case nil:
+				return nil
+			case rql.ErrorList:
+				list = e
+			case *rql.Error:
+				list = rql.ErrorList{e}
+			default:
+				list = rql.ErrorList{{Name: name, Line: 1, Column: 1, Msg: err.Error()}}
+			}
+			for _, e := range list {
+				if asJSON {
+					json.NewEncoder(os.Stdout).Encode(diagnostic{
+						Name:    e.Name,
+						Line:    e.Line,
+						Column:  e.Column,
+						Offset:  int(e.Pos),
+						Message: e.Msg,
+					})
+				} else {
+					fmt.Printf("%s:%d:%d: %s\n", e.Name, e.Line, e.Column, e.Msg)
+				}
+			}
+			return errors.New("invalid RQL")
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "describe errors as JSON")
+	return cmd
+}
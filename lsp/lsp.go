@@ -0,0 +1,426 @@
+// Package lsp implements a Language Server Protocol server for RQL, serving
+// diagnostics, completion, hover documentation and formatting to editors
+// over a JSON-RPC connection such as standard input and output.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+// Server is an RQL language server
+type Server struct {
+	Schema *rql.Schema // fields offered for completion and validated, optional
+
+	in   *bufio.Reader
+	out  io.Writer
+	mu   sync.Mutex // guards writes to out
+	docs map[string]string
+	shut bool
+}
+
+// NewServer returns a Server reading requests from in and writing responses
+// and notifications to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]string{},
+	}
+}
+
+// message is a JSON-RPC request, notification or response
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInvalidRequest = -32600
+)
+
+// maxContentLength bounds the size of a message body, as the body is read
+// into memory whole
+const maxContentLength = 64 << 20
+
+// Position is a zero-based line and UTF-16 character offset in a document
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span of a document
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type textDocument struct {
+	URI     string `json:"uri"`
+	Text    string `json:"text"`
+	Version int    `json:"version"`
+}
+
+type positionParams struct {
+	TextDocument textDocument `json:"textDocument"`
+	Position     Position     `json:"position"`
+}
+
+type diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type completionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Detail        string `json:"detail,omitempty"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+type textEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// completion item kinds
+const (
+	kindFunction = 3
+	kindField    = 5
+	kindKeyword  = 14
+)
+
+// Serve handles messages until the client sends exit or the input ends
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			s.reply(nil, nil, &responseError{codeParseError, "invalid JSON"})
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID != nil {
+			s.reply(msg.ID, result, rerr)
+		}
+	}
+}
+
+// read reads a single Content-Length framed message; a nil message is
+// returned for a body which is not valid JSON
+func (s *Server) read() (*message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 || length > maxContentLength {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// write frames and writes a message
+func (s *Server) write(msg *message) {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err *responseError) {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	if err == nil && result == nil {
+		result = json.RawMessage("null")
+	}
+	s.write(&message{ID: id, Result: result, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(&message{Method: method, Params: raw})
+}
+
+// handle dispatches a request or notification, returning the result of
+// requests
+func (s *Server) handle(msg *message) (interface{}, *responseError) {
+	if s.shut && msg.Method != "exit" {
+		return nil, &responseError{codeInvalidRequest, "server is shut down"}
+	}
+	var params positionParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1,
+				"completionProvider":         map[string]interface{}{"triggerCharacters": []string{"(", ","}},
+				"hoverProvider":              true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "rql"},
+		}, nil
+	case "shutdown":
+		s.shut = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.update(uri, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var change struct {
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &change); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+		if n := len(change.ContentChanges); n > 0 {
+			s.update(uri, change.ContentChanges[n-1].Text)
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": []diagnostic{}})
+	case "textDocument/completion":
+		return s.completion(), nil
+	case "textDocument/hover":
+		return s.hover(s.docs[uri], params.Position), nil
+	case "textDocument/formatting":
+		return s.format(s.docs[uri]), nil
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+	default:
+		if msg.ID != nil {
+			return nil, &responseError{codeMethodNotFound, "method not found: " + msg.Method}
+		}
+	}
+	return nil, nil
+}
+
+// update stores the text of a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	s.docs[uri] = text
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": s.diagnostics(text),
+	})
+}
+
+// diagnostics returns the parse errors of the text, or the errors of
+// validating it against the Schema
+func (s *Server) diagnostics(text string) []diagnostic {
+	diags := []diagnostic{}
+	t := rql.New("rql")
+	t.Mode = rql.RecoverErrors
+	if _, err := t.Parse(text); err != nil {
+		list, ok := err.(rql.ErrorList)
+		if !ok {
+			return append(diags, diagnostic{Severity: 1, Source: "rql", Message: err.Error()})
+		}
+		for _, e := range list {
+			diags = append(diags, errorDiagnostic(text, e))
+		}
+		return diags
+	}
+	if s.Schema != nil {
+		for _, e := range s.Schema.Validate(t) {
+			diags = append(diags, errorDiagnostic(text, e))
+		}
+	}
+	return diags
+}
+
+// errorDiagnostic converts an error into a diagnostic spanning the word at
+// its position
+func errorDiagnostic(text string, e *rql.Error) diagnostic {
+	start := int(e.Pos)
+	if start > len(text) {
+		start = len(text)
+	}
+	end := start
+	for end < len(text) && isWordByte(text[end]) {
+		end++
+	}
+	if end == start && end < len(text) {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	return diagnostic{
+		Range:    Range{position(text, start), position(text, end)},
+		Severity: 1,
+		Source:   "rql",
+		Message:  e.Msg,
+	}
+}
+
+// completion returns the operators, functions and schema fields
+func (s *Server) completion() []completionItem {
+	items := []completionItem{}
+	for _, name := range rql.OperatorNames() {
+		doc, _ := rql.Describe(name)
+		items = append(items, completionItem{Label: name, Kind: kindKeyword, Detail: "operator", Documentation: doc})
+	}
+	for _, name := range rql.FunctionNames() {
+		doc, _ := rql.Describe(name)
+		items = append(items, completionItem{Label: name, Kind: kindFunction, Detail: "function", Documentation: doc})
+	}
+	if s.Schema != nil {
+		for _, name := range sortedFields(s.Schema) {
+			items = append(items, completionItem{Label: name, Kind: kindField, Detail: s.Schema.Fields[name].String()})
+		}
+	}
+	return items
+}
+
+// hover returns the documentation of the operator or function at pos
+func (s *Server) hover(text string, pos Position) interface{} {
+	start, end := wordAt(text, offset(text, pos))
+	if start == end {
+		return nil
+	}
+	word := text[start:end]
+	doc, ok := rql.Describe(word)
+	if !ok {
+		if s.Schema == nil {
+			return nil
+		}
+		typ, ok := s.Schema.Fields[word]
+		if !ok {
+			return nil
+		}
+		doc = word + " is a " + typ.String() + " field."
+	}
+	if doc == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{"kind": "plaintext", "value": doc},
+		"range":    Range{position(text, start), position(text, end)},
+	}
+}
+
+// format returns an edit replacing the whole text with its formatted form,
+// or no edits if the text does not parse
+func (s *Server) format(text string) []textEdit {
+	formatted, err := rql.Format("rql", text)
+	if err != nil || formatted == text {
+		return []textEdit{}
+	}
+	return []textEdit{{
+		Range:   Range{Position{}, position(text, len(text))},
+		NewText: formatted,
+	}}
+}
+
+// sortedFields returns the names of the schema's fields, sorted
+func sortedFields(schema *rql.Schema) []string {
+	names := []string{}
+	for name := range schema.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '.' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+// wordAt returns the bounds of the identifier containing the byte offset
+func wordAt(text string, off int) (int, int) {
+	start, end := off, off
+	for start > 0 && isWordByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordByte(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+// position converts a byte offset into an LSP position
+func position(text string, off int) Position {
+	line := strings.Count(text[:off], "\n")
+	start := strings.LastIndexByte(text[:off], '\n') + 1
+	char := 0
+	for _, r := range text[start:off] {
+		char += len(utf16.Encode([]rune{r}))
+	}
+	return Position{Line: line, Character: char}
+}
+
+// offset converts an LSP position into a byte offset, clamped to the text
+func offset(text string, pos Position) int {
+	off := 0
+	for i := 0; i < pos.Line; i++ {
+		n := strings.IndexByte(text[off:], '\n')
+		if n < 0 {
+			return len(text)
+		}
+		off += n + 1
+	}
+	for char := 0; char < pos.Character && off < len(text) && text[off] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[off:])
+		char += len(utf16.Encode([]rune{r}))
+		off += size
+	}
+	return off
+}
@@ -0,0 +1,135 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	rql "github.com/zikes/rql/parse"
+)
+
+// session runs the server over the given messages and returns the messages
+// it wrote
+func session(t *testing.T, schema *rql.Schema, msgs ...string) []map[string]interface{} {
+	in := new(bytes.Buffer)
+	for _, m := range msgs {
+		fmt.Fprintf(in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	out := new(bytes.Buffer)
+	s := NewServer(in, out)
+	s.Schema = schema
+	if err := s.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	replies := []map[string]interface{}{}
+	r := bufio.NewReader(out)
+	for {
+		s := &Server{in: r}
+		msg, err := s.read()
+		if err != nil {
+			break
+		}
+		raw, _ := json.Marshal(msg)
+		reply := map[string]interface{}{}
+		json.Unmarshal(raw, &reply)
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func open(text string) string {
+	raw, _ := json.Marshal(text)
+	return `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.rql","text":` + string(raw) + `}}}`
+}
+
+func TestContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "99999999999", "ten"} {
+		in := strings.NewReader("Content-Length: " + length + "\r\n\r\n{}")
+		if err := NewServer(in, new(bytes.Buffer)).Serve(); err == nil {
+			t.Errorf("expected error for Content-Length %s; got none", length)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	replies := session(t, nil, open("and(\n  eq(a,1),\n  foo(b,2),\n  eq(c 3)\n)"))
+	if len(replies) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(replies))
+	}
+	params := replies[0]["params"].(map[string]interface{})
+	diags := params["diagnostics"].([]interface{})
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diags)
+	}
+	r := diags[0].(map[string]interface{})["range"].(map[string]interface{})
+	start := r["start"].(map[string]interface{})
+	if start["line"] != 2.0 || start["character"] != 2.0 {
+		t.Errorf("diagnostic at %v, expected line 2 character 2", start)
+	}
+}
+
+func TestSchemaDiagnostics(t *testing.T) {
+	schema, err := rql.LoadSchema(strings.NewReader(`{"a":"number"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies := session(t, schema, open(`and(eq(a,1),eq(b,2))`))
+	diags := replies[0]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if len(diags) != 1 || !strings.Contains(diags[0].(map[string]interface{})["message"].(string), `"b"`) {
+		t.Errorf("expected unknown field b, got %v", diags)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	schema, _ := rql.LoadSchema(strings.NewReader(`{"email":"string"}`))
+	replies := session(t, schema,
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/completion","params":{"textDocument":{"uri":"file:///a.rql"},"position":{"line":0,"character":0}}}`)
+	labels := map[string]bool{}
+	for _, item := range replies[0]["result"].([]interface{}) {
+		labels[item.(map[string]interface{})["label"].(string)] = true
+	}
+	for _, want := range []string{"and", "match", "lower", "email"} {
+		if !labels[want] {
+			t.Errorf("expected completion %q", want)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	replies := session(t, nil, open(`and(eq(a,1))`),
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.rql"},"position":{"line":0,"character":5}}}`)
+	result := replies[1]["result"].(map[string]interface{})
+	value := result["contents"].(map[string]interface{})["value"].(string)
+	if !strings.HasPrefix(value, "eq(") {
+		t.Errorf("unexpected hover %q", value)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	replies := session(t, nil, open(`and( eq(a,1) ,eq(b,2))`),
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/formatting","params":{"textDocument":{"uri":"file:///a.rql"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`)
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(replies))
+	}
+	edits := replies[1]["result"].([]interface{})
+	if len(edits) != 1 || edits[0].(map[string]interface{})["newText"] != "and(eq(a, 1), eq(b, 2))\n" {
+		t.Errorf("unexpected edits %v", edits)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	text := "a\né€x"
+	off := strings.Index(text, "x")
+	pos := position(text, off)
+	if pos != (Position{1, 2}) {
+		t.Errorf("position(%d) = %v", off, pos)
+	}
+	if got := offset(text, pos); got != off {
+		t.Errorf("offset(%v) = %d, expected %d", pos, got, off)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 	goquadapter "github.com/zikes/rql/adapters/goqu"
@@ -10,35 +12,115 @@ import (
 )
 
 func main() {
+	var paths, file, dialect, table string
+	var prepared, where bool
 	var cmdSql = &cobra.Command{
-		Use:   "sql [string to parse]",
-		Short: "Converts RQL to SQL",
-		Long:  `sql converts RQL input into SQL output`,
-		Run: func(cmd *cobra.Command, args []string) {
-			t, err := rql.New("root").Parse(args[0])
+		Use:          "sql [string to parse]",
+		Short:        "Converts RQL to SQL",
+		Long:         `sql converts RQL input into SQL output`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := parseInput(file, args)
 			if err != nil {
-				fmt.Println("Error parsing RQL: %s", err)
-				return
+				return err
 			}
-			fmt.Println(sqladapter.ToSQL(t.Root))
+			sqladapter.DefaultTranslator.Paths = pathStrategy(paths)
+			sql, err := sqladapter.ToSQL(t.Root)
+			if err != nil {
+				return err
+			}
+			fmt.Println(sql)
+			return nil
 		},
 	}
 	var cmdGoqu = &cobra.Command{
 		Use:   "goqu [string to parse]",
 		Short: "Converts RQL to SQL via goqu",
-		Long:  `sql converts RQL input into SQL output via goqu`,
-		Run: func(cmd *cobra.Command, args []string) {
-			t, err := rql.New("root").Parse(args[0])
+		Long: `goqu converts RQL input into SQL output via goqu, in the goqu dialect
+chosen with --dialect. With --prepared, values are replaced by placeholders
+and listed in a trailing comment. With --where, only the predicate of the
+WHERE clause is printed.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := parseInput(file, args)
+			if err != nil {
+				return err
+			}
+			tr := &goquadapter.Translator{Paths: pathStrategy(paths), Dialect: dialect, Prepared: prepared}
+			var sql string
+			var sqlArgs []interface{}
+			if where {
+				sql, sqlArgs, err = tr.ToWhere(t.Root)
+			} else {
+				sql, sqlArgs, err = tr.ToSQL(t.Root, table)
+			}
 			if err != nil {
-				fmt.Println("Error parsing RQL: %s", err)
-				return
+				return err
+			}
+			fmt.Println(sql)
+			if prepared {
+				fmt.Printf("-- args: %v\n", sqlArgs)
 			}
-			fmt.Println(goquadapter.ToSQL(t.Root))
+			return nil
 		},
 	}
+	cmdGoqu.Flags().StringVar(&dialect, "dialect", "", "goqu dialect: postgres, mysql, sqlite3 or sqlserver")
+	cmdGoqu.Flags().BoolVar(&prepared, "prepared", false, "use placeholders and print the arguments")
+	cmdGoqu.Flags().StringVar(&table, "table", "test", "table to select from")
+	cmdGoqu.Flags().BoolVar(&where, "where", false, "print only the WHERE predicate")
 
 	var rootCmd = &cobra.Command{Use: "rql"}
+	rootCmd.PersistentFlags().StringVar(&paths, "paths", "column", "resolution of dotted identifiers: column, jsonb, json_extract or document")
+	rootCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "read RQL from the named file, or standard input if -")
 	rootCmd.AddCommand(cmdSql)
 	rootCmd.AddCommand(cmdGoqu)
-	rootCmd.Execute()
+	rootCmd.AddCommand(newFmtCommand())
+	rootCmd.AddCommand(newValidateCommand(&file))
+	rootCmd.AddCommand(newASTCommand(&file))
+	rootCmd.AddCommand(newREPLCommand())
+	rootCmd.AddCommand(newEvalCommand(&file))
+	rootCmd.AddCommand(newLSPCommand())
+	rootCmd.AddCommand(newFromSQLCommand(&file))
+	rootCmd.AddCommand(newODataCommand(&file))
+	rootCmd.AddCommand(newFromODataCommand(&file))
+	rootCmd.AddCommand(newCELCommand(&file))
+	rootCmd.AddCommand(newFromCELCommand(&file))
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func pathStrategy(name string) rql.PathStrategy {
+	p, ok := rql.ParsePathStrategy(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown path strategy %q, using column\n", name)
+	}
+	return p
+}
+
+// readQuery returns the RQL to operate on and a name for it: the contents
+// of file if one was given, else the first argument, else standard input.
+func readQuery(file string, args []string) (name, text string, err error) {
+	switch {
+	case file != "" && len(args) > 0:
+		return "", "", errors.New("cannot use both --file and an argument")
+	case file == "-", file == "" && len(args) == 0:
+		b, err := readInput("-")
+		return "stdin", string(b), err
+	case file != "":
+		b, err := readInput(file)
+		return file, string(b), err
+	}
+	return "root", args[0], nil
+}
+
+// parseInput parses the RQL chosen by readQuery
+func parseInput(file string, args []string) (*rql.Tree, error) {
+	name, text, err := readQuery(file, args)
+	if err != nil {
+		return nil, err
+	}
+	return rql.New(name).Parse(text)
 }
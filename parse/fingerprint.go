@@ -0,0 +1,136 @@
+package rql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Placeholder replaces literals in a Fingerprint
+const Placeholder = "?"
+
+// Hash returns a stable hash of the query, as hexadecimal SHA-256, for
+// use as a cache key. Queries which differ only in whitespace, comments,
+// the spelling of literals, the order and nesting of the operands of and
+// and or, or in giving its values as a list or as separate operands have
+// the same hash.
+func Hash(t *Tree) string {
+	sum := sha256.Sum256([]byte(canonical(t, false)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint returns the shape of the query, for grouping queries which
+// differ only in their values, like the normalized statements of
+// pg_stat_statements. It is the query in the canonical form used by Hash,
+// with every literal but null replaced by the Placeholder, and lists of
+// literals, such as the values of in, by a single one:
+//
+//	and(gt(age,21),in(id,(1,2,3)))  ->  and(gt(age,?),in(id,(?)))
+//	and(ne(name,null),in(id,1,2))   ->  and(in(id,(?)),ne(name,null))
+func Fingerprint(t *Tree) string {
+	return canonical(t, true)
+}
+
+// canonical returns the canonical form of the tree
+func canonical(t *Tree, placeholders bool) string {
+	if t == nil || t.Root == nil || t.Root.Operator == nil {
+		return ""
+	}
+	c := canonicalizer{placeholders: placeholders}
+	return c.node(t.Root.Operator)
+}
+
+// canonicalizer renders nodes in canonical form
+type canonicalizer struct {
+	placeholders bool // replace literals with the Placeholder
+}
+
+func (c canonicalizer) node(n Node) string {
+	switch n := n.(type) {
+	case *OperatorNode:
+		if n.Operator == "in" && len(n.Operands.Nodes) > 0 {
+			return "in(" + c.node(n.Operands.Nodes[0]) + "," + c.list(c.values(n.Operands.Nodes[1:]), c.placeholders) + ")"
+		}
+		if n.Operator != "and" && n.Operator != "or" {
+			return n.Operator + c.list(n.Operands, false)
+		}
+		// and and or are commutative and associative, so nested operators
+		// of the same kind are flattened and the operands sorted
+		operands := []string{}
+		for _, v := range c.flatten(n.Operator, n.Operands.Nodes) {
+			operands = append(operands, c.node(v))
+		}
+		sort.Strings(operands)
+		return n.Operator + "(" + strings.Join(operands, ",") + ")"
+	case *FunctionNode:
+		return n.Name + c.list(n.Args, false)
+	case *ListNode:
+		return c.list(n, c.placeholders)
+	case *IdentifierNode, *NullNode, *ErrorNode:
+		// null changes the meaning of a comparison, so it is part of the
+		// shape rather than a value
+		return n.String()
+	}
+	if c.placeholders {
+		return Placeholder
+	}
+	switch n := n.(type) {
+	case *StringNode:
+		return strconv.Quote(n.Text)
+	case *NumberNode:
+		if n.IsInt {
+			return strconv.FormatInt(n.Int64, 10)
+		}
+		if n.IsUint {
+			return strconv.FormatUint(n.Uint64, 10)
+		}
+		return strconv.FormatFloat(n.Float64, 'g', -1, 64)
+	}
+	return n.String()
+}
+
+// list renders a parenthesized list, collapsing a list of only literals to
+// a single placeholder if collapse is set
+func (c canonicalizer) list(l *ListNode, collapse bool) string {
+	str := []string{}
+	literals := len(l.Nodes) > 0
+	for _, v := range l.Nodes {
+		s := c.node(v)
+		literals = literals && s == Placeholder
+		str = append(str, s)
+	}
+	if collapse && literals {
+		return "(" + Placeholder + ")"
+	}
+	return "(" + strings.Join(str, ",") + ")"
+}
+
+// values returns the values of in as a single list, as in may give them as
+// lists, separate operands, or both
+func (c canonicalizer) values(nodes []Node) *ListNode {
+	values := &ListNode{}
+	for _, v := range nodes {
+		if l, ok := v.(*ListNode); ok {
+			values.Nodes = append(values.Nodes, l.Nodes...)
+			continue
+		}
+		values.Nodes = append(values.Nodes, v)
+	}
+	return values
+}
+
+// flatten returns the operands of op, replacing nested operators of the
+// same kind with their operands
+func (c canonicalizer) flatten(op string, nodes []Node) []Node {
+	flat := []Node{}
+	for _, v := range nodes {
+		if o, ok := v.(*OperatorNode); ok && o.Operator == op {
+			flat = append(flat, c.flatten(op, o.Operands.Nodes)...)
+			continue
+		}
+		flat = append(flat, v)
+	}
+	return flat
+}
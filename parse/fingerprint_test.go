@@ -0,0 +1,68 @@
+package rql
+
+import "testing"
+
+var fingerprintTests = []struct {
+	name        string
+	input       string
+	fingerprint string
+}{
+	{"empty", ``, ``},
+	{"comparison", `eq(id,12)`, `eq(id,?)`},
+	{"sorted", `and(gt(age,21),eq(status,"open"))`, `and(eq(status,?),gt(age,?))`},
+	{"flattened", `or(eq(a,1),or(eq(b,2),and(eq(d,4),eq(c,3))))`, `or(and(eq(c,?),eq(d,?)),eq(a,?),eq(b,?))`},
+	{"in", `in(id,(1,2,3))`, `in(id,(?))`},
+	{"variadic in", `in(id,1,2,3)`, `in(id,(?))`},
+	{"mixed in", `in(id,(1,2),3)`, `in(id,(?))`},
+	{"null", `and(eq(name,null),ne(age,null))`, `and(eq(name,null),ne(age,null))`},
+	{"null in list", `in(id,(1,null))`, `in(id,(?,null))`},
+	{"match", `match(email,"@example\\.com$","i")`, `match(email,?,?)`},
+	{"functions", `and(gt(add(price,1),10),ne(lower(name),null))`, `and(gt(add(price,?),?),ne(lower(name),null))`},
+	{"predicate", `any(orders,and(lt(total,5),gt(qty,0)))`, `any(orders,and(gt(qty,?),lt(total,?)))`},
+}
+
+func TestFingerprint(t *testing.T) {
+	for _, test := range fingerprintTests {
+		tree, err := New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		if got := Fingerprint(tree); got != test.fingerprint {
+			t.Errorf("%s: expected\n  %s\ngot\n  %s", test.name, test.fingerprint, got)
+		}
+	}
+}
+
+var hashTests = []struct {
+	name  string
+	a, b  string
+	equal bool
+}{
+	{"whitespace", `and(eq(id,12), gt(age,21))`, "and(\n  eq(id,12),\n  gt(age,21) # adults\n)", true},
+	{"commutative", `and(eq(id,12),gt(age,21))`, `and(gt(age,21),eq(id,12))`, true},
+	{"associative", `or(eq(a,1),or(eq(b,2),eq(c,3)))`, `or(or(eq(c,3),eq(a,1)),eq(b,2))`, true},
+	{"literals", `and(eq(ratio,1.50),eq(name,"A"))`, `and(eq(ratio,1.5),eq(name,"A"))`, true},
+	{"values", `eq(id,12)`, `eq(id,13)`, false},
+	{"operand order", `lt(a,b)`, `lt(b,a)`, false},
+	{"list order", `in(id,(1,2))`, `in(id,(2,1))`, false},
+	{"variadic in", `in(id,1,2)`, `in(id,(1,2))`, true},
+	{"null", `eq(name,null)`, `eq(name,"null")`, false},
+	{"and or", `and(eq(a,1),eq(b,2))`, `or(eq(a,1),eq(b,2))`, false},
+	{"types", `eq(id,"12")`, `eq(id,12)`, false},
+}
+
+func TestHash(t *testing.T) {
+	for _, test := range hashTests {
+		a, err := New(test.name).Parse(test.a)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		b, err := New(test.name).Parse(test.b)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		if equal := Hash(a) == Hash(b); equal != test.equal {
+			t.Errorf("%s: expected equal hashes to be %v for\n  %s\n  %s", test.name, test.equal, test.a, test.b)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package rql
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ValueType identifies the type of value an operand evaluates to
+type ValueType int
+
+// ValueType constants
+const (
+	TypeAny    ValueType = iota // type is not known until evaluation
+	TypeString                  // a string value
+	TypeNumber                  // a numeric value
+	TypeBool                    // a boolean value
+	TypeTime                    // a date or timestamp
+)
+
+var valueTypeName = map[ValueType]string{
+	TypeAny:    "any",
+	TypeString: "string",
+	TypeNumber: "number",
+	TypeBool:   "boolean",
+	TypeTime:   "time",
+}
+
+// String returns the name of the ValueType
+func (v ValueType) String() string {
+	return valueTypeName[v]
+}
+
+// MarshalText returns the name of the ValueType
+func (v ValueType) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText sets the ValueType from its name
+func (v *ValueType) UnmarshalText(text []byte) error {
+	for typ, name := range valueTypeName {
+		if name == string(text) {
+			*v = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown type %q", text)
+}
+
+// accepts reports whether a value of type o may be used where v is expected
+func (v ValueType) accepts(o ValueType) bool {
+	switch {
+	case v == TypeAny, o == TypeAny, v == o:
+		return true
+	case v == TypeTime && o == TypeString:
+		// timestamps are written as string literals
+		return true
+	}
+	return false
+}
+
+// Function describes a scalar function which may be used in operand
+// positions, such as lower in eq(lower(email),"x@y.com").
+type Function struct {
+	Name     string      // name used in RQL
+	Args     []ValueType // types of the arguments
+	Variadic bool        // whether the last argument may repeat
+	Result   ValueType   // type of the returned value
+	Doc      string      // short description, shown by editors
+}
+
+var (
+	functionsMu sync.RWMutex
+	functions   = map[string]Function{}
+)
+
+func init() {
+	for _, f := range []Function{
+		{Name: "lower", Args: []ValueType{TypeString}, Result: TypeString, Doc: "Lowercase a string."},
+		{Name: "upper", Args: []ValueType{TypeString}, Result: TypeString, Doc: "Uppercase a string."},
+		{Name: "trim", Args: []ValueType{TypeString}, Result: TypeString, Doc: "Strip leading and trailing spaces."},
+		{Name: "length", Args: []ValueType{TypeString}, Result: TypeNumber, Doc: "Number of characters in a string."},
+		{Name: "abs", Args: []ValueType{TypeNumber}, Result: TypeNumber, Doc: "Absolute value of a number."},
+		{Name: "year", Args: []ValueType{TypeTime}, Result: TypeNumber, Doc: "Year of a date or timestamp."},
+		{Name: "month", Args: []ValueType{TypeTime}, Result: TypeNumber, Doc: "Month of a date or timestamp."},
+		{Name: "day", Args: []ValueType{TypeTime}, Result: TypeNumber, Doc: "Day of the month of a date or timestamp."},
+
+		// arithmetic
+		{Name: "add", Args: []ValueType{TypeNumber, TypeNumber}, Result: TypeNumber, Doc: "Sum of two numbers."},
+		{Name: "sub", Args: []ValueType{TypeNumber, TypeNumber}, Result: TypeNumber, Doc: "Difference of two numbers."},
+		{Name: "mul", Args: []ValueType{TypeNumber, TypeNumber}, Result: TypeNumber, Doc: "Product of two numbers."},
+		{Name: "div", Args: []ValueType{TypeNumber, TypeNumber}, Result: TypeNumber, Doc: "Quotient of two numbers."},
+		{Name: "mod", Args: []ValueType{TypeNumber, TypeNumber}, Result: TypeNumber, Doc: "Remainder of dividing two numbers."},
+	} {
+		RegisterFunction(f)
+	}
+}
+
+// RegisterFunction makes a scalar function available to the parser. Adapters
+// must also know how to translate it. Registering a name twice replaces the
+// earlier definition. A variadic function must declare at least one
+// argument, which may repeat.
+func RegisterFunction(f Function) error {
+	if f.Variadic && len(f.Args) == 0 {
+		return fmt.Errorf("variadic function %q must declare an argument", f.Name)
+	}
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+	functions[f.Name] = f
+	return nil
+}
+
+// LookupFunction returns the registered function with the given name
+func LookupFunction(name string) (Function, bool) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	f, ok := functions[name]
+	return f, ok
+}
+
+// FunctionNames returns the names of the registered functions, sorted
+func FunctionNames() []string {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	names := []string{}
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check validates the number and types of the arguments of a call to f
+func (f Function) Check(args []Node) error {
+	return checkArgs(f.Name, "arguments", f.Args, f.Variadic, args)
+}
+
+// checkArgs validates args against a signature of types, naming them noun
+// in errors
+func checkArgs(name, noun string, types []ValueType, variadic bool, args []Node) error {
+	switch {
+	case variadic && len(args) < len(types):
+		return fmt.Errorf("%s expects at least %d %s, got %d", name, len(types), noun, len(args))
+	case !variadic && len(args) != len(types):
+		return fmt.Errorf("%s expects %d %s, got %d", name, len(types), noun, len(args))
+	}
+	for i, arg := range args {
+		want := types[len(types)-1]
+		if i < len(types) {
+			want = types[i]
+		}
+		got, ok := TypeOf(arg)
+		if !ok {
+			return fmt.Errorf("%s %s %d must be a value, got %s", name, noun[:len(noun)-1], i+1, arg)
+		}
+		if !want.accepts(got) {
+			return fmt.Errorf("%s %s %d must be %s, got %s", name, noun[:len(noun)-1], i+1, want, got)
+		}
+	}
+	return nil
+}
+
+// Arithmetic maps the names of the arithmetic functions to their infix operators
+var Arithmetic = map[string]string{
+	"add": "+",
+	"sub": "-",
+	"mul": "*",
+	"div": "/",
+	"mod": "%",
+}
+
+// TypeOf returns the type of value the node evaluates to. It reports false
+// for nodes which are not values, such as operators and lists.
+func TypeOf(n Node) (ValueType, bool) {
+	switch n := n.(type) {
+	case *StringNode:
+		return TypeString, true
+	case *NumberNode:
+		return TypeNumber, true
+	case *BoolNode:
+		return TypeBool, true
+	case *NullNode, *IdentifierNode:
+		return TypeAny, true
+	case *FunctionNode:
+		if f, ok := LookupFunction(n.Name); ok {
+			return f.Result, true
+		}
+		return TypeAny, true
+	}
+	return TypeAny, false
+}
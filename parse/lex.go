@@ -43,6 +43,7 @@ const (
 	itemRightParen // ')'
 	itemComma      // ','
 	itemWhitespace // white space separating arguments
+	itemComment    // # line comment or /* block comment */, including delimiters
 
 	itemKeyword // used only to delimit keywords
 
@@ -56,6 +57,13 @@ const (
 	itemLe             // le keyword
 	itemGe             // ge keyword
 	itemIn             // in keyword
+	itemAny            // any keyword
+	itemAll            // all keyword
+	itemContains       // contains keyword
+	itemOverlaps       // overlaps keyword
+	itemSize           // size keyword
+	itemMatch          // match keyword
+	itemCustom         // registered custom operator
 	itemOperatorsEnd   // used only to delimit operators
 
 	itemNull // null keyword
@@ -72,6 +80,13 @@ var key = map[string]itemType{
 	"ge":   itemGe,
 	"in":   itemIn,
 	"null": itemNull,
+
+	"any":      itemAny,
+	"all":      itemAll,
+	"contains": itemContains,
+	"overlaps": itemOverlaps,
+	"size":     itemSize,
+	"match":    itemMatch,
 }
 
 var operators = []itemType{
@@ -84,6 +99,13 @@ var operators = []itemType{
 	itemLe,
 	itemGe,
 	itemIn,
+	itemAny,
+	itemAll,
+	itemContains,
+	itemOverlaps,
+	itemSize,
+	itemMatch,
+	itemCustom,
 }
 
 const eof = -1
@@ -133,7 +155,7 @@ func (l *lexer) backup() {
 func (l *lexer) emit(t itemType) {
 	l.items <- item{t, l.start, l.input[l.start:l.pos], l.line}
 	switch t {
-	case itemWhitespace, itemString:
+	case itemWhitespace, itemString, itemComment:
 		l.line += strings.Count(l.input[l.start:l.pos], "\n")
 	}
 	l.start = l.pos
@@ -198,6 +220,11 @@ func lexStatement(l *lexer) stateFn {
 		return nil
 	case isWhitespace(r):
 		return lexWhitespace
+	case r == '#':
+		return lexLineComment
+	case r == '/' && l.peek() == '*':
+		l.next()
+		return lexBlockComment
 	case r == '"':
 		return lexString
 	case r == '.' || r == '+' || r == '-' || ('0' <= r && r <= '9'):
@@ -231,6 +258,26 @@ func lexWhitespace(l *lexer) stateFn {
 	return lexStatement
 }
 
+// lexLineComment scans a comment running to the end of the line
+func lexLineComment(l *lexer) stateFn {
+	for r := l.peek(); r != '\n' && r != eof; r = l.peek() {
+		l.next()
+	}
+	l.emit(itemComment)
+	return lexStatement
+}
+
+// lexBlockComment scans a comment delimited by /* and */
+func lexBlockComment(l *lexer) stateFn {
+	i := strings.Index(l.input[l.pos:], "*/")
+	if i < 0 {
+		return l.errorf("unclosed comment")
+	}
+	l.pos += Pos(i + len("*/"))
+	l.emit(itemComment)
+	return lexStatement
+}
+
 // lexIdentifier scans an identifier
 func lexIdentifier(l *lexer) stateFn {
 Loop:
@@ -250,6 +297,8 @@ Loop:
 				l.emit(key[word])
 			case word == "true", word == "false":
 				l.emit(itemBool)
+			case isCustomOperator(word):
+				l.emit(itemCustom)
 			default:
 				l.emit(itemIdentifier)
 			}
@@ -310,14 +359,19 @@ func (l *lexer) atTerminator() bool {
 		return true
 	}
 	switch r {
-	case eof, '.', ',', ')', '(':
+	case eof, '.', ',', ')', '(', '#', '/':
 		return true
 	}
 	return false
 }
 
+func isCustomOperator(word string) bool {
+	_, ok := LookupOperator(word)
+	return ok
+}
+
 func isWhitespace(r rune) bool {
-	return r == ' ' || r == '\t' || r == '\n'
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
 }
 
 func isAlphaNumeric(r rune) bool {
@@ -18,6 +18,7 @@ var itemName = map[itemType]string{
 	itemLeftParen:  "(",
 	itemRightParen: ")",
 	itemWhitespace: "whitespace",
+	itemComment:    "comment",
 
 	itemAnd:  "and",
 	itemOr:   "or",
@@ -29,6 +30,14 @@ var itemName = map[itemType]string{
 	itemGe:   "ge",
 	itemIn:   "in",
 	itemNull: "null",
+
+	itemAny:      "any",
+	itemAll:      "all",
+	itemContains: "contains",
+	itemOverlaps: "overlaps",
+	itemSize:     "size",
+	itemMatch:    "match",
+	itemCustom:   "custom",
 }
 
 func (i itemType) String() string {
@@ -66,6 +75,12 @@ var (
 	tLe         = mkItem(itemLe, "le")
 	tGe         = mkItem(itemGe, "ge")
 	tIn         = mkItem(itemIn, "in")
+	tAny        = mkItem(itemAny, "any")
+	tAll        = mkItem(itemAll, "all")
+	tContains   = mkItem(itemContains, "contains")
+	tOverlaps   = mkItem(itemOverlaps, "overlaps")
+	tSize       = mkItem(itemSize, "size")
+	tMatch      = mkItem(itemMatch, "match")
 	tNull       = mkItem(itemNull, "null")
 	tTrue       = mkItem(itemBool, "true")
 	tFalse      = mkItem(itemBool, "false")
@@ -95,6 +110,12 @@ var lexTests = []lexTest{
 	{"le", "le", []item{tLe, tEOF}},
 	{"ge", "ge", []item{tGe, tEOF}},
 	{"in", "in", []item{tIn, tEOF}},
+	{"any", "any", []item{tAny, tEOF}},
+	{"all", "all", []item{tAll, tEOF}},
+	{"contains", "contains", []item{tContains, tEOF}},
+	{"overlaps", "overlaps", []item{tOverlaps, tEOF}},
+	{"size", "size", []item{tSize, tEOF}},
+	{"match", "match", []item{tMatch, tEOF}},
 	{"null", "null", []item{tNull, tEOF}},
 	{"true", "true", []item{tTrue, tEOF}},
 	{"false", "false", []item{tFalse, tEOF}},
@@ -122,6 +143,10 @@ var lexTests = []lexTest{
 		tRightParen,
 		tEOF,
 	}},
+	{"line comment", "# note\neq", []item{mkItem(itemComment, "# note"), mkItem(itemWhitespace, "\n"), tEq, tEOF}},
+	{"block comment", "eq/* a\nb */(", []item{tEq, mkItem(itemComment, "/* a\nb */"), tLeftParen, mkItem(itemError, "unexpected end of statement")}},
+	{"comment after identifier", "id# note", []item{mkItem(itemIdentifier, "id"), mkItem(itemComment, "# note"), tEOF}},
+	{"carriage return", "eq\r\n", []item{tEq, mkItem(itemWhitespace, "\r\n"), tEOF}},
 
 	// errors
 	{"badchar", "\x01", []item{
@@ -134,6 +159,8 @@ var lexTests = []lexTest{
 	{"unterminated identifier", "abc123\x01", []item{
 		mkItem(itemError, "bad character U+0001"),
 	}},
+	{"unclosed comment", "/* note", []item{mkItem(itemError, "unclosed comment")}},
+	{"lone slash", "/", []item{mkItem(itemError, "unrecognized character in statement: U+002F '/'")}},
 	{"newline in string", `"\` + "\n", []item{
 		mkItem(itemError, "unterminated quoted string"),
 	}},
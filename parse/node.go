@@ -57,13 +57,36 @@ const (
 	NodeOperator                   // An operator
 	NodeList                       // A list of nodes.
 	NodeStatement                  // A statement node.
+	NodeFunction                   // A scalar function call.
+	NodeComment                    // A comment.
+	NodeError                      // An operand which could not be parsed.
 )
 
+var nodeTypeName = map[NodeType]string{
+	NodeBool:       "bool",
+	NodeIdentifier: "identifier",
+	NodeNull:       "null",
+	NodeString:     "string",
+	NodeNumber:     "number",
+	NodeOperator:   "operator",
+	NodeList:       "list",
+	NodeStatement:  "statement",
+	NodeFunction:   "function",
+	NodeComment:    "comment",
+	NodeError:      "error",
+}
+
+// String returns the name of the NodeType, such as "identifier"
+func (t NodeType) String() string {
+	return nodeTypeName[t]
+}
+
 // ListNode holds a sequence of Nodes
 type ListNode struct {
 	NodeType
 	Pos
 	tr    *Tree
+	end   Pos    // position of the closing parenthesis
 	Nodes []Node // The element nodes in lexical order
 }
 
@@ -97,6 +120,7 @@ func (l *ListNode) CopyList() *ListNode {
 		return l
 	}
 	n := l.tr.newList(l.Pos)
+	n.end = l.end
 	for _, elem := range l.Nodes {
 		n.append(elem.Copy())
 	}
@@ -175,6 +199,17 @@ func (i *IdentifierNode) String() string {
 	return i.Ident
 }
 
+// Path returns the dot-separated segments of the identifier, so that
+// "user.address.city" yields ["user", "address", "city"].
+func (i *IdentifierNode) Path() []string {
+	return strings.Split(i.Ident, ".")
+}
+
+// IsPath reports whether the identifier refers to a nested field.
+func (i *IdentifierNode) IsPath() bool {
+	return strings.Contains(i.Ident, ".")
+}
+
 func (i *IdentifierNode) tree() *Tree {
 	return i.tr
 }
@@ -374,3 +409,84 @@ func (o *OperatorNode) tree() *Tree {
 func (o *OperatorNode) Copy() Node {
 	return o.tr.newOperator(o.Operator, o.Pos, o.Operands.CopyList())
 }
+
+// FunctionNode holds a scalar function call used as an operand.
+type FunctionNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Name string    // The function's name.
+	Args *ListNode // The function's arguments.
+}
+
+func (t *Tree) newFunction(name string, pos Pos, args *ListNode) *FunctionNode {
+	return &FunctionNode{NodeType: NodeFunction, tr: t, Name: name, Pos: pos, Args: args}
+}
+
+// String returns the string representation of the FunctionNode
+func (f *FunctionNode) String() string {
+	return fmt.Sprintf("%s%s", f.Name, f.Args)
+}
+
+func (f *FunctionNode) tree() *Tree {
+	return f.tr
+}
+
+// Copy returns a copy of the FunctionNode
+func (f *FunctionNode) Copy() Node {
+	return f.tr.newFunction(f.Name, f.Pos, f.Args.CopyList())
+}
+
+// CommentNode holds a comment.
+type CommentNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Text string // Comment text, including the # or /* */ delimiters.
+}
+
+func (t *Tree) newComment(pos Pos, text string) *CommentNode {
+	return &CommentNode{tr: t, NodeType: NodeComment, Pos: pos, Text: text}
+}
+
+// String returns the text of the CommentNode
+func (c *CommentNode) String() string {
+	return c.Text
+}
+
+func (c *CommentNode) tree() *Tree {
+	return c.tr
+}
+
+// Copy returns a copy of the CommentNode
+func (c *CommentNode) Copy() Node {
+	return c.tr.newComment(c.Pos, c.Text)
+}
+
+// ErrorNode replaces an operand which could not be parsed in RecoverErrors
+// mode.
+type ErrorNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Text string // The source text which was skipped.
+	Err  *Error // The error reported for the operand.
+}
+
+func (t *Tree) newErrorNode(pos Pos, text string, err *Error) *ErrorNode {
+	return &ErrorNode{tr: t, NodeType: NodeError, Pos: pos, Text: text, Err: err}
+}
+
+// String returns the source text of the ErrorNode
+func (e *ErrorNode) String() string {
+	return e.Text
+}
+
+func (e *ErrorNode) tree() *Tree {
+	return e.tr
+}
+
+// Copy returns a copy of the ErrorNode
+func (e *ErrorNode) Copy() Node {
+	return e.tr.newErrorNode(e.Pos, e.Text, e.Err)
+}
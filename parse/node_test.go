@@ -8,6 +8,15 @@ func TestNodeType_Type(t *testing.T) {
 	}
 }
 
+func TestNodeType_String(t *testing.T) {
+	if NodeIdentifier.String() != "identifier" {
+		t.Errorf("unexpected NodeType.String() value %q", NodeIdentifier.String())
+	}
+	if NewIdentifier("id").Type().String() != "identifier" {
+		t.Errorf("unexpected NodeType.String() value for IdentifierNode")
+	}
+}
+
 func TestListNode_Tree(t *testing.T) {
 	node := &ListNode{tr: nil, NodeType: NodeList, Pos: Pos(0)}
 	if node.tree() != nil {
@@ -87,3 +96,41 @@ func TestStringNode_Copy(t *testing.T) {
 		t.Errorf("unexpected StringNode.Copy() value")
 	}
 }
+
+func TestIdentifierNode_Path(t *testing.T) {
+	node := NewIdentifier("user.address.city")
+	if !node.IsPath() {
+		t.Errorf("expected IdentifierNode.IsPath() to be true")
+	}
+	if path := node.Path(); len(path) != 3 || path[0] != "user" || path[2] != "city" {
+		t.Errorf("unexpected IdentifierNode.Path() value %q", path)
+	}
+	if NewIdentifier("city").IsPath() {
+		t.Errorf("expected IdentifierNode.IsPath() to be false")
+	}
+}
+
+func TestParsePathStrategy(t *testing.T) {
+	for _, p := range []PathStrategy{PathColumn, PathJSONB, PathJSONExtract, PathDocument} {
+		got, ok := ParsePathStrategy(p.String())
+		if !ok || got != p {
+			t.Errorf("ParsePathStrategy(%q) mismatch", p)
+		}
+	}
+	if _, ok := ParsePathStrategy("unknown"); ok {
+		t.Errorf("expected ParsePathStrategy to fail for unknown name")
+	}
+}
+
+func TestFunctionNode_Copy(t *testing.T) {
+	tree := New("root")
+	args := tree.newList(Pos(0))
+	args.append(NewIdentifier("email"))
+	node := tree.newFunction("lower", Pos(0), args)
+	if node.Copy().String() != "lower(email)" {
+		t.Errorf("unexpected FunctionNode.Copy() value")
+	}
+	if node.tree() != tree {
+		t.Errorf("unexpected FunctionNode.tree() value")
+	}
+}
@@ -0,0 +1,119 @@
+package rql
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Operator describes a custom operator, such as near(location,lat,lng,km).
+// Once registered the lexer recognizes its name, and the parser checks its
+// operands against the signature. Each adapter needs its own translation,
+// registered with that adapter.
+type Operator struct {
+	Name     string      // name used in RQL
+	Operands []ValueType // types of the operands
+	Variadic bool        // whether the last operand may repeat
+	Doc      string      // short description, shown by editors
+}
+
+// operatorDocs describes the built-in operators
+var operatorDocs = map[string]string{
+	"and":      "and(value, value, ...) is true when every operand is true.",
+	"or":       "or(value, value, ...) is true when any operand is true.",
+	"eq":       "eq(value, value) tests equality; eq(value, null) tests for null.",
+	"ne":       "ne(value, value) tests inequality; ne(value, null) tests for non-null.",
+	"lt":       "lt(value, value) is a less than comparison.",
+	"gt":       "gt(value, value) is a greater than comparison.",
+	"le":       "le(value, value) is a less than or equals comparison.",
+	"ge":       "ge(value, value) is a greater than or equals comparison.",
+	"in":       "in(value, (value, ...)) checks if the value is one of a series.",
+	"any":      "any(array, predicate) is true when some element satisfies the predicate; _ is the element.",
+	"all":      "all(array, predicate) is true when every element satisfies the predicate; _ is the element.",
+	"contains": "contains(array, (value, ...)) is true when the array contains every value.",
+	"overlaps": "overlaps(array, (value, ...)) is true when the array contains any of the values.",
+	"size":     "size(array, number) is true when the array has that many elements.",
+	"match":    "match(value, pattern[, flags]) matches a regular expression; flags may include i and m.",
+}
+
+// OperatorNames returns the names of the built-in and registered custom
+// operators, sorted
+func OperatorNames() []string {
+	names := []string{}
+	for _, typ := range operators {
+		for name, t := range key {
+			if t == typ {
+				names = append(names, name)
+			}
+		}
+	}
+	operatorsMu.RLock()
+	for name := range custom {
+		names = append(names, name)
+	}
+	operatorsMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the documentation of the named operator or function
+func Describe(name string) (string, bool) {
+	if doc, ok := operatorDocs[name]; ok {
+		return doc, true
+	}
+	if op, ok := LookupOperator(name); ok {
+		return op.Doc, true
+	}
+	if f, ok := LookupFunction(name); ok {
+		return f.Doc, true
+	}
+	return "", false
+}
+
+var (
+	operatorsMu sync.RWMutex
+	custom      = map[string]Operator{}
+)
+
+// RegisterOperator makes a custom operator available to the lexer and parser.
+// Registering a name twice replaces the earlier definition. The names of the
+// built-in operators and keywords cannot be registered, and a variadic
+// operator must declare at least one operand, which may repeat.
+func RegisterOperator(op Operator) error {
+	if _, ok := key[op.Name]; ok || op.Name == "true" || op.Name == "false" {
+		return fmt.Errorf("cannot register reserved name %q", op.Name)
+	}
+	if op.Name == "" || !isIdentifier(op.Name) {
+		return fmt.Errorf("invalid operator name %q", op.Name)
+	}
+	if op.Variadic && len(op.Operands) == 0 {
+		return fmt.Errorf("variadic operator %q must declare an operand", op.Name)
+	}
+	operatorsMu.Lock()
+	defer operatorsMu.Unlock()
+	custom[op.Name] = op
+	return nil
+}
+
+// LookupOperator returns the registered custom operator with the given name
+func LookupOperator(name string) (Operator, bool) {
+	operatorsMu.RLock()
+	defer operatorsMu.RUnlock()
+	op, ok := custom[name]
+	return op, ok
+}
+
+// Check validates the number and types of the operands of op
+func (o Operator) Check(operands []Node) error {
+	return checkArgs(o.Name, "operands", o.Operands, o.Variadic, operands)
+}
+
+// isIdentifier reports whether s lexes as a single identifier
+func isIdentifier(s string) bool {
+	for _, r := range s {
+		if !isAlphaNumeric(r) || r == '.' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,31 +2,51 @@ package rql
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // Tree is the representation of a single parsed statement
 type Tree struct {
-	Name string         // The name of the statement represented by the tree
-	Root *StatementNode // top-level root of the tree
-	text string         // The text to be parsed
+	Name     string         // The name of the statement represented by the tree
+	Root     *StatementNode // top-level root of the tree
+	Mode     Mode           // parsing mode
+	Comments []*CommentNode // comments in lexical order, if Mode has ParseComments
+	text     string         // The text to be parsed
 
 	// Parsing only; cleared after parse.
 	lex       *lexer
 	token     [3]item // three-token lookahead for parser
 	peekCount int
+	errors    ErrorList // errors collected in RecoverErrors mode
+	eof       bool      // input ended while recovering from an error
 }
 
+// Mode is a set of flags (or 0). Modes control parser behavior.
+type Mode uint
+
+// Mode flags
+const (
+	ParseComments Mode = 1 << iota // collect comments into Tree.Comments
+	RecoverErrors                  // collect every error, returning a partial tree
+)
+
 // Copy returns a copy of the Tree. Any parsing state is discarded.
 func (t *Tree) Copy() *Tree {
 	if t == nil {
 		return nil
 	}
+	var comments []*CommentNode
+	for _, c := range t.Comments {
+		comments = append(comments, c.Copy().(*CommentNode))
+	}
 	return &Tree{
-		Name: t.Name,
-		Root: t.Root.CopyStatement(),
-		text: t.text,
+		Name:     t.Name,
+		Root:     t.Root.CopyStatement(),
+		Mode:     t.Mode,
+		Comments: comments,
+		text:     t.text,
 	}
 }
 
@@ -65,11 +85,14 @@ func (t *Tree) peek() item {
 	return t.token[0]
 }
 
-// nextNonSpace returns the next non-whitespace token
+// nextNonSpace returns the next token which is neither whitespace nor a comment
 func (t *Tree) nextNonSpace() (token item) {
 	for {
 		token = t.next()
-		if token.typ != itemWhitespace {
+		if token.typ == itemComment && t.Mode&ParseComments != 0 {
+			t.Comments = append(t.Comments, t.newComment(token.pos, token.val))
+		}
+		if token.typ != itemWhitespace && token.typ != itemComment {
 			break
 		}
 	}
@@ -78,12 +101,7 @@ func (t *Tree) nextNonSpace() (token item) {
 
 // peekNonSpace returns but does not consume the next non-space token
 func (t *Tree) peekNonSpace() (token item) {
-	for {
-		token = t.next()
-		if token.typ != itemWhitespace {
-			break
-		}
-	}
+	token = t.nextNonSpace()
 	t.backup()
 	return token
 }
@@ -120,11 +138,81 @@ func (t *Tree) ErrorContext(n Node) (location, context string) {
 	return fmt.Sprintf("%s:%d:%d", tree.Name, lineNum, byteNum), context
 }
 
+// Error describes a problem found while parsing, and where it was found
+type Error struct {
+	Name   string // name of the tree being parsed
+	Pos    Pos    // byte offset of the problem in the input
+	Line   int    // line of the problem, starting at 1
+	Column int    // byte offset within the line, starting at 1
+	Msg    string // description of the problem
+}
+
+// Error returns the error formatted with its name and line
+func (e *Error) Error() string {
+	return fmt.Sprintf("statement: %s:%d: %s", e.Name, e.Line, e.Msg)
+}
+
+// ErrorList is the list of errors returned by Parse in RecoverErrors mode,
+// in order of position
+type ErrorList []*Error
+
+// Error returns the first error and the number of others
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// bailout abandons the operand being parsed in RecoverErrors mode, after its
+// error has been collected
+type bailout struct {
+	err *Error
+}
+
+// newError returns an Error at the given position of the tree's text
+func (t *Tree) newError(pos Pos, msg string) *Error {
+	if int(pos) > len(t.text) {
+		pos = Pos(len(t.text))
+	}
+	text := t.text[:pos]
+	return &Error{
+		Name:   t.Name,
+		Pos:    pos,
+		Line:   1 + strings.Count(text, "\n"),
+		Column: 1 + len(text) - (strings.LastIndex(text, "\n") + 1),
+		Msg:    msg,
+	}
+}
+
 // errorf formats the error and terminates processing
 func (t *Tree) errorf(format string, args ...interface{}) {
+	t.errorAt(t.token[0].pos, format, args...)
+}
+
+// errorAt formats the error at the given position and terminates processing,
+// or in RecoverErrors mode collects it and abandons the current operand
+func (t *Tree) errorAt(pos Pos, format string, args ...interface{}) {
+	err := t.newError(pos, fmt.Sprintf(format, args...))
+	if t.Mode&RecoverErrors != 0 {
+		t.errors = append(t.errors, err)
+		panic(bailout{err})
+	}
 	t.Root = nil
-	format = fmt.Sprintf("statement: %s:%d: %s", t.Name, t.token[0].line, format)
-	panic(fmt.Errorf(format, args...))
+	panic(err)
+}
+
+// invalid reports an error in a node which was parsed successfully. Unlike
+// errorAt it does not abandon the node in RecoverErrors mode.
+func (t *Tree) invalid(pos Pos, format string, args ...interface{}) {
+	if t.Mode&RecoverErrors != 0 {
+		t.errors = append(t.errors, t.newError(pos, fmt.Sprintf(format, args...)))
+		return
+	}
+	t.errorAt(pos, format, args...)
 }
 
 // error terminates processing
@@ -159,7 +247,10 @@ func (t *Tree) expectOneOf(expected []itemType, context string) item {
 
 // unexpected complains about the token and terminates processing
 func (t *Tree) unexpected(token item, context string) {
-	t.errorf("unexpected %s in %s", token, context)
+	if token.typ == itemError {
+		t.errorAt(token.pos, "%s", token.val)
+	}
+	t.errorAt(token.pos, "unexpected %s in %s", token, context)
 }
 
 // recover is the handler that turns panics into returns from the top level of Parse
@@ -170,6 +261,10 @@ func (t *Tree) recover(errp *error) {
 			t.lex.drain()
 			t.stopParse()
 		}
+		if _, ok := e.(bailout); ok {
+			*errp = t.errors
+			return
+		}
 		*errp = e.(error)
 	}
 	return
@@ -178,6 +273,9 @@ func (t *Tree) recover(errp *error) {
 // startParse intiializes the parser, using the lexer.
 func (t *Tree) startParse(lex *lexer) {
 	t.Root = nil
+	t.Comments = nil
+	t.errors = nil
+	t.eof = false
 	t.lex = lex
 }
 
@@ -187,13 +285,22 @@ func (t *Tree) stopParse() {
 }
 
 // Parse parses the statement string to construct a representation of the statement for
-// translation.
+// translation. In RecoverErrors mode the tree is returned even if there are
+// errors, with operands which could not be parsed replaced by ErrorNodes, and
+// the error is an ErrorList.
 func (t *Tree) Parse(text string) (tree *Tree, err error) {
 	defer t.recover(&err)
 	t.startParse(lex(t.Name, text))
 	t.text = text
+	if t.Mode&RecoverErrors != 0 {
+		tree = t
+	}
 	t.parse()
 	t.stopParse()
+	if len(t.errors) > 0 {
+		sort.SliceStable(t.errors, func(i, j int) bool { return t.errors[i].Pos < t.errors[j].Pos })
+		return t, t.errors
+	}
 	return t, nil
 }
 
@@ -215,6 +322,12 @@ func IsEmptyTree(n Node) bool {
 	case *NumberNode:
 	case *StringNode:
 		return false
+	case *FunctionNode:
+		return false
+	case *CommentNode:
+		return true
+	case *ErrorNode:
+		return false
 	case *OperatorNode:
 		return IsEmptyTree(n.Operands)
 	case *StatementNode:
@@ -236,60 +349,191 @@ func (t *Tree) parse() {
 	if itemOperatorsStart <= op.typ && op.typ <= itemOperatorsEnd {
 		t.Root.Operator = t.operator()
 	}
+	if t.eof {
+		return
+	}
 	tok := t.nextNonSpace()
-	if tok.typ != itemEOF {
-		t.errorf("unexpected token after operator: %q", tok)
+	switch tok.typ {
+	case itemEOF:
+	case itemError:
+		t.errorAt(tok.pos, "%s", tok.val)
+	default:
+		t.errorAt(tok.pos, "unexpected token after operator: %q", tok)
 	}
 }
 
 // operator returns an operator
 func (t *Tree) operator() *OperatorNode {
 	token := t.expectOneOf(operators, "operator")
-	return t.newOperator(token.val, token.pos, t.list())
+	return t.check(t.newOperator(token.val, token.pos, t.list()))
+}
+
+// check validates the operands of operators which constrain them
+func (t *Tree) check(op *OperatorNode) *OperatorNode {
+	if t.eof || hasErrorNode(op.Operands) {
+		return op
+	}
+	switch op.Operator {
+	case "match":
+		if _, err := CompileMatch(op); err != nil {
+			t.invalid(op.Pos, "%s", err)
+		}
+	case "eq", "ne", "lt", "gt", "le", "ge":
+		if len(op.Operands.Nodes) != 2 {
+			break
+		}
+		left, _ := TypeOf(op.Operands.Nodes[0])
+		right, _ := TypeOf(op.Operands.Nodes[1])
+		if !left.accepts(right) && !right.accepts(left) {
+			t.invalid(op.Pos, "%s cannot compare %s with %s", op.Operator, left, right)
+		}
+	default:
+		if custom, ok := LookupOperator(op.Operator); ok {
+			if err := custom.Check(op.Operands.Nodes); err != nil {
+				t.invalid(op.Pos, "%s", err)
+			}
+		}
+	}
+	return op
+}
+
+// hasErrorNode reports whether any operand of the list is an ErrorNode
+func hasErrorNode(l *ListNode) bool {
+	for _, n := range l.Nodes {
+		if _, ok := n.(*ErrorNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// function returns a scalar function call, checking it against the registry
+func (t *Tree) function(name item) *FunctionNode {
+	f, ok := LookupFunction(name.val)
+	if !ok {
+		t.invalid(name.pos, "unknown function %q", name.val)
+	}
+	fn := t.newFunction(name.val, name.pos, t.list())
+	if !ok || t.eof || hasErrorNode(fn.Args) {
+		return fn
+	}
+	if err := f.Check(fn.Args.Nodes); err != nil {
+		t.invalid(name.pos, "%s", err)
+	}
+	return fn
 }
 
 func (t *Tree) list() *ListNode {
 	list := t.newList(t.expect(itemLeftParen, "left parentheses").pos)
-	expectComma := false
-Loop:
-	for {
-		if expectComma {
-			tok := t.expectOneOf([]itemType{itemComma, itemRightParen}, "comma or right parentheses")
-			if tok.typ == itemRightParen {
-				t.backup()
-			}
+	for expectComma := false; !t.operand(list, expectComma) && !t.eof; expectComma = true {
+	}
+	return list
+}
+
+// operand parses the next operand of the list, preceded by a comma if
+// expectComma is set, and reports whether the closing parenthesis was found
+// instead. In RecoverErrors mode an operand with a syntax error is replaced by
+// an ErrorNode.
+func (t *Tree) operand(list *ListNode, expectComma bool) (end bool) {
+	if t.Mode&RecoverErrors != 0 {
+		defer t.resync(list, &end)
+	}
+	if expectComma {
+		tok := t.expectOneOf([]itemType{itemComma, itemRightParen}, "comma or right parentheses")
+		if tok.typ == itemRightParen {
+			t.backup()
+		}
+	}
+	switch token := t.nextNonSpace(); {
+	case token.typ == itemIdentifier:
+		if t.peekNonSpace().typ == itemLeftParen {
+			list.append(t.function(token))
+			break
+		}
+		list.append(NewIdentifier(token.val).SetTree(t).SetPos(token.pos))
+	case token.typ == itemString:
+		s, err := strconv.Unquote(token.val)
+		if err != nil {
+			t.error(err)
+		}
+		list.append(t.newString(token.pos, token.val, s))
+	case token.typ == itemBool:
+		list.append(t.newBool(token.pos, token.val == "true"))
+	case token.typ == itemNumber:
+		number, err := t.newNumber(token.pos, token.val)
+		if err != nil {
+			t.error(err)
 		}
-		switch token := t.nextNonSpace(); {
-		case token.typ == itemIdentifier:
+		list.append(number)
+	case token.typ == itemNull:
+		list.append(t.newNull(token.pos))
+	case itemOperatorsStart <= token.typ && token.typ <= itemOperatorsEnd:
+		// an operator name not followed by operands is a plain identifier,
+		// so that columns such as "size" remain addressable
+		if t.peekNonSpace().typ != itemLeftParen {
 			list.append(NewIdentifier(token.val).SetTree(t).SetPos(token.pos))
-		case token.typ == itemString:
-			s, err := strconv.Unquote(token.val)
-			if err != nil {
-				t.error(err)
+			break
+		}
+		list.append(t.check(t.newOperator(token.val, token.pos, t.list())))
+	case token.typ == itemLeftParen:
+		t.backup()
+		l := t.list()
+		list.append(l)
+	case token.typ == itemRightParen:
+		list.end = token.pos
+		return true
+	case token.typ == itemError:
+		t.errorAt(token.pos, "%s", token.val)
+	}
+	return false
+}
+
+// resync recovers from a bailout while parsing an operand of the list,
+// skipping to the next comma or closing parenthesis of the list and appending
+// an ErrorNode for the skipped text. If the input ends first, parsing of every
+// enclosing list stops.
+func (t *Tree) resync(list *ListNode, end *bool) {
+	e := recover()
+	if e == nil {
+		return
+	}
+	b, ok := e.(bailout)
+	if !ok {
+		panic(e)
+	}
+	var stop Pos
+Skip:
+	for depth := 0; ; {
+		tok := t.nextNonSpace()
+		switch tok.typ {
+		case itemLeftParen:
+			depth++
+		case itemRightParen:
+			if depth == 0 {
+				t.backup()
+				stop = tok.pos
+				break Skip
 			}
-			list.append(t.newString(token.pos, token.val, s))
-		case token.typ == itemBool:
-			list.append(t.newBool(token.pos, token.val == "true"))
-		case token.typ == itemNumber:
-			number, err := t.newNumber(token.pos, token.val)
-			if err != nil {
-				t.error(err)
+			depth--
+		case itemComma:
+			if depth == 0 {
+				t.backup()
+				stop = tok.pos
+				break Skip
 			}
-			list.append(number)
-		case token.typ == itemNull:
-			list.append(t.newNull(token.pos))
-		case itemOperatorsStart <= token.typ && token.typ <= itemOperatorsEnd:
-			t.backup()
-			op := t.operator()
-			list.append(op)
-		case token.typ == itemLeftParen:
-			t.backup()
-			l := t.list()
-			list.append(l)
-		case token.typ == itemRightParen:
-			break Loop
+		case itemEOF, itemError:
+			if tok.typ == itemError && tok.val != "" {
+				t.errors = append(t.errors, t.newError(tok.pos, tok.val))
+			}
+			t.eof = true
+			*end = true
+			stop = Pos(len(t.text))
+			break Skip
 		}
-		expectComma = true
 	}
-	return list
+	start := b.err.Pos
+	if start > stop {
+		start = stop
+	}
+	list.append(t.newErrorNode(start, strings.TrimSpace(t.text[start:stop]), b.err))
 }
@@ -39,14 +39,39 @@ var parseTests = []parseTest{
 	{"multiple value", `eq(id, -12.3, "test")`, noError, `eq(id,-12.3,"test")`},
 	{"nested operators", `and(eq(id,12),gt(age,21))`, noError, `and(eq(id,12),gt(age,21))`},
 	{"in - non-empty", `in(first_name, ("Jason","Kevin"))`, noError, `in(first_name,("Jason","Kevin"))`},
+	{"contains", `contains(tags, ("a","b"))`, noError, `contains(tags,("a","b"))`},
+	{"overlaps", `overlaps(tags, ("a","b"))`, noError, `overlaps(tags,("a","b"))`},
+	{"size", `size(tags, 3)`, noError, `size(tags,3)`},
+	{"any", `any(items, gt(price, 10))`, noError, `any(items,gt(price,10))`},
+	{"all", `all(items, and(gt(price, 10), eq(_, null)))`, noError, `all(items,and(gt(price,10),eq(_,null)))`},
+	{"match", `match(hostname, "^web-[0-9]+$")`, noError, `match(hostname,"^web-[0-9]+$")`},
+	{"match with flags", `match(hostname, "^WEB", "i")`, noError, `match(hostname,"^WEB","i")`},
+	{"function", `eq(lower(email), "x@y.com")`, noError, `eq(lower(email),"x@y.com")`},
+	{"nested function", `gt(length(trim(name)), 3)`, noError, `gt(length(trim(name)),3)`},
+	{"function on right", `eq(year(created), year("2024-01-01"))`, noError, `eq(year(created),year("2024-01-01"))`},
+	{"arithmetic", `gt(mul(price, 1.2), 100)`, noError, `gt(mul(price,1.2),100)`},
+	{"arithmetic on both sides", `gt(sub(end, start), add(3000, 600))`, noError, `gt(sub(end,start),add(3000,600))`},
+	{"comments", "# filter\nand( # ids\n\teq(id, /* answer */ 42),\n\tgt(age, 21) # adults\n)", noError, `and(eq(id,42),gt(age,21))`},
+	{"keyword as identifier", `eq(size, 3)`, noError, `eq(size,3)`},
+	{"keyword as last identifier", `eq(3, size)`, noError, `eq(3,size)`},
 
 	// errors
 	{"unexpected token", `12`, hasError, `statement: unexpected token:1: unexpected token after operator: "\"12\""`},
 	{"unexpected token 2", `eq(id 12)`, hasError, `statement: unexpected token 2:1: unexpected "12" in comma or right parentheses`},
 	{"unexpected token 3", `eq,(id 12)`, hasError, `statement: unexpected token 3:1: unexpected "," in left parentheses`},
-	{"unterminated string", `eq(id,"test)`, hasError, `statement: unterminated string:0: unexpected  in comma or right parentheses`},
-	{"invalid number", `eq(-12e3)`, hasError, `statement: invalid number:0: unexpected  in comma or right parentheses`},
-	{"number", "eq(+2.2.2)", hasError, `statement: number:0: unexpected  in comma or right parentheses`},
+	{"unterminated string", `eq(id,"test)`, hasError, `statement: unterminated string:1: unterminated quoted string`},
+	{"invalid number", `eq(-12e3)`, hasError, `statement: invalid number:1: bad number syntax: "-12e"`},
+	{"invalid pattern", `match(hostname, "web-(")`, hasError, "statement: invalid pattern:1: error parsing regexp: missing closing ): `web-(`"},
+	{"invalid flags", `match(hostname, "web", "x")`, hasError, `statement: invalid flags:1: unknown match flag 'x'`},
+	{"non-string pattern", `match(hostname, 12)`, hasError, `statement: non-string pattern:1: match pattern must be a string, got 12`},
+	{"match arity", `match(hostname)`, hasError, `statement: match arity:1: match expects 2 or 3 operands, got 1`},
+	{"unknown function", `eq(nope(email), 1)`, hasError, `statement: unknown function:1: unknown function "nope"`},
+	{"function arity", `eq(lower(email, name), 1)`, hasError, `statement: function arity:1: lower expects 1 arguments, got 2`},
+	{"function type", `eq(length(12), 1)`, hasError, `statement: function type:1: length argument 1 must be string, got number`},
+	{"nested function type", `eq(abs(lower(name)), 1)`, hasError, `statement: nested function type:1: abs argument 1 must be number, got string`},
+	{"arithmetic type", `gt(add(price, "1"), 100)`, hasError, `statement: arithmetic type:1: add argument 2 must be number, got string`},
+	{"comparison type", `gt(mul(price, 2), "100")`, hasError, `statement: comparison type:1: gt cannot compare number with string`},
+	{"number", "eq(+2.2.2)", hasError, `statement: number:1: bad number syntax: "+2.2."`},
 }
 
 func testParse(doCopy bool, t *testing.T) {
@@ -271,6 +296,7 @@ func TestIsEmpty(t *testing.T) {
 		tree.newOperator("eq", Pos(0), listNode),
 		tree.newBool(Pos(0), true),
 		tree.newString(Pos(0), "", ""),
+		tree.newFunction("lower", Pos(0), listNode),
 		num,
 		&mysteryNode{},
 	}
@@ -295,6 +321,209 @@ func TestPeekBackup(t *testing.T) {
 	}
 }
 
+var customOperatorTests = []parseTest{
+	{"custom", `near(location, 51.5, -0.12, 10)`, noError, `near(location,51.5,-0.12,10)`},
+	{"nested custom", `and(hasRole(user, "admin"), eq(id, 12))`, noError, `and(hasRole(user,"admin"),eq(id,12))`},
+	{"custom as identifier", `eq(near, 12)`, noError, `eq(near,12)`},
+	{"custom arity", `near(location, 51.5)`, hasError, `statement: custom arity:1: near expects 4 operands, got 2`},
+	{"custom type", `hasRole(user, 12)`, hasError, `statement: custom type:1: hasRole operand 2 must be string, got number`},
+}
+
+func TestRegisterFunction(t *testing.T) {
+	if err := RegisterFunction(Function{Name: "coalesce", Variadic: true}); err == nil {
+		t.Errorf("expected registration error for variadic function without arguments; got none")
+	}
+	if _, ok := LookupFunction("coalesce"); ok {
+		t.Errorf("expected the rejected function not to be registered")
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	for _, op := range []Operator{
+		{Name: "near", Operands: []ValueType{TypeAny, TypeNumber, TypeNumber, TypeNumber}},
+		{Name: "hasRole", Operands: []ValueType{TypeAny, TypeString}},
+	} {
+		if err := RegisterOperator(op); err != nil {
+			t.Fatalf("unexpected registration failure: %v", err)
+		}
+	}
+	for _, name := range []string{"eq", "null", "true", "bad-name", "a.b", ""} {
+		if err := RegisterOperator(Operator{Name: name}); err == nil {
+			t.Errorf("%q: expected registration error; got none", name)
+		}
+	}
+	if err := RegisterOperator(Operator{Name: "tagged", Variadic: true}); err == nil {
+		t.Errorf("expected registration error for variadic operator without operands; got none")
+	}
+	for _, test := range customOperatorTests {
+		stmt, err := New(test.name).Parse(test.input)
+		switch {
+		case err == nil && !test.ok:
+			t.Errorf("%q: expected error; got none", test.name)
+		case err != nil && test.ok:
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+		case err != nil && !test.ok:
+			if err.Error() != test.result {
+				t.Errorf("%q: error mismatch: expected\n  %s\ngot\n  %s", test.name, test.result, err)
+			}
+		case stmt.Root.String() != test.result:
+			t.Errorf("%s=(%q): got\n\t%v\nexpected\n\t%v", test.name, test.input, stmt.Root, test.result)
+		}
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	input := "# filter\nand(\n\teq(id, /* answer */ 42) # ids\n)"
+	tree := New("comments")
+	tree.Mode = ParseComments
+	if _, err := tree.Parse(input); err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	want := []string{"# filter", "/* answer */", "# ids"}
+	if len(tree.Comments) != len(want) {
+		t.Fatalf("expected %d comments, got %d", len(want), len(tree.Comments))
+	}
+	for i, c := range tree.Comments {
+		if c.Text != want[i] {
+			t.Errorf("comment %d: expected %q got %q", i, want[i], c.Text)
+		}
+		if input[c.Pos:int(c.Pos)+len(c.Text)] != c.Text {
+			t.Errorf("comment %d: wrong position %d", i, c.Pos)
+		}
+	}
+	if !reflect.DeepEqual(tree.Copy().Comments, tree.Comments) {
+		t.Errorf("Tree.Copy() comments mismatch")
+	}
+
+	tree, err := New("no comments").Parse(input)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	if len(tree.Comments) != 0 {
+		t.Errorf("expected comments to be discarded, got %d", len(tree.Comments))
+	}
+}
+
+var errorPositionTests = []struct {
+	name   string
+	input  string
+	line   int
+	column int
+}{
+	{"unexpected token", "and(\n  eq(id 12)\n)", 2, 9},
+	{"unterminated string", "and(\n\teq(id, \"test))", 2, 9},
+	{"unknown function", "eq(\n  nope(id), 1)", 2, 3},
+	{"comparison type", "and(eq(id,1),\n gt(mul(price,2),\"100\"))", 2, 2},
+}
+
+func TestErrorPosition(t *testing.T) {
+	for _, test := range errorPositionTests {
+		_, err := New(test.name).Parse(test.input)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q: expected *Error, got %T", test.name, err)
+			continue
+		}
+		if e.Line != test.line || e.Column != test.column {
+			t.Errorf("%q: expected %d:%d got %d:%d (%s)", test.name, test.line, test.column, e.Line, e.Column, e)
+		}
+	}
+}
+
+var recoveryTests = []struct {
+	name   string
+	input  string
+	tree   string   // the partial tree, with ErrorNodes printed as their text
+	errors []string // line:column: message of each error
+}{
+	{"none", "and(eq(a,1),eq(b,2))", "and(eq(a,1),eq(b,2))", nil},
+	{"three mistakes", "and(\n  eq(a 1),\n  nope(b),\n  gt(1,true),\n  lt(d,2)\n)", "and(eq(a,1),nope(b),gt(1,true),lt(d,2))", []string{
+		"2:8: unexpected \"1\" in comma or right parentheses",
+		"3:3: unknown function \"nope\"",
+		"4:3: gt cannot compare number with boolean",
+	}},
+	{"nested", "or(eq(a,1 2 3),ne(b,(1 2)),eq(c,3))", "or(eq(a,1,2 3),ne(b,(1,2)),eq(c,3))", []string{
+		"1:11: unexpected \"2\" in comma or right parentheses",
+		"1:24: unexpected \"2\" in comma or right parentheses",
+	}},
+	{"comparison", "and(gt(a,\"x\"),lt(1,true))", "and(gt(a,\"x\"),lt(1,true))", []string{
+		"1:15: lt cannot compare number with boolean",
+	}},
+	{"unterminated", "and(eq(a,1),eq(b,", "and(eq(a,1),eq(b,))", []string{
+		"1:18: unexpected end of statement",
+	}},
+}
+
+func TestRecoverErrors(t *testing.T) {
+	for _, test := range recoveryTests {
+		tr := New(test.name)
+		tr.Mode = RecoverErrors
+		tree, err := tr.Parse(test.input)
+		if tree == nil {
+			t.Errorf("%s: expected a partial tree, got error %v", test.name, err)
+			continue
+		}
+		if got := tree.Root.String(); got != test.tree {
+			t.Errorf("%s: expected tree %s got %s", test.name, test.tree, got)
+		}
+		var errs ErrorList
+		if err != nil {
+			errs = err.(ErrorList)
+		}
+		got := []string{}
+		for _, e := range errs {
+			got = append(got, fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg))
+		}
+		if len(got) != len(test.errors) {
+			t.Errorf("%s: expected errors %q got %q", test.name, test.errors, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.errors[i] {
+				t.Errorf("%s: expected error %q got %q", test.name, test.errors[i], got[i])
+			}
+		}
+	}
+}
+
+func TestErrorNodes(t *testing.T) {
+	tr := New("errors")
+	tr.Mode = RecoverErrors
+	tree, _ := tr.Parse("and(eq(a 1 (2)),eq(b,2))")
+	eq := tree.Root.Operator.Operands.Nodes[0].(*OperatorNode)
+	e, ok := eq.Operands.Nodes[1].(*ErrorNode)
+	if !ok {
+		t.Fatalf("expected an ErrorNode, got %T", eq.Operands.Nodes[1])
+	}
+	if e.Text != "1 (2)" || e.Pos != 9 || e.Err == nil {
+		t.Errorf("unexpected ErrorNode %q at %d: %v", e.Text, e.Pos, e.Err)
+	}
+}
+
+func TestOperatorNames(t *testing.T) {
+	names := OperatorNames()
+	for _, name := range []string{"and", "eq", "in", "match"} {
+		found := false
+		for _, n := range names {
+			found = found || n == name
+		}
+		if !found {
+			t.Errorf("expected %q in OperatorNames()", name)
+		}
+		if doc, ok := Describe(name); !ok || doc == "" {
+			t.Errorf("expected documentation for %q", name)
+		}
+	}
+	for _, n := range names {
+		if n == "null" {
+			t.Errorf("unexpected keyword %q in OperatorNames()", n)
+		}
+	}
+	if doc, ok := Describe("lower"); !ok || doc == "" {
+		t.Errorf("expected documentation for lower")
+	}
+}
+
 type numberTest struct {
 	text    string
 	isInt   bool
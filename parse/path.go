@@ -0,0 +1,54 @@
+package rql
+
+// PathStrategy determines how an adapter resolves a dotted identifier
+// such as "user.address.city" into a field reference.
+type PathStrategy int
+
+// PathStrategy constants
+const (
+	PathColumn      PathStrategy = iota // schema/table qualified column: "user"."address"."city"
+	PathJSONB                           // PostgreSQL JSONB traversal: "user"->'address'->>'city'
+	PathJSONExtract                     // MySQL JSON_EXTRACT: JSON_EXTRACT(`user`, '$.address.city')
+	PathDocument                        // nested document path, as used by Mongo: user.address.city
+)
+
+var pathStrategyName = map[PathStrategy]string{
+	PathColumn:      "column",
+	PathJSONB:       "jsonb",
+	PathJSONExtract: "json_extract",
+	PathDocument:    "document",
+}
+
+// String returns the name of the PathStrategy
+func (p PathStrategy) String() string {
+	return pathStrategyName[p]
+}
+
+// ParsePathStrategy returns the PathStrategy with the given name, as
+// returned by PathStrategy.String.
+func ParsePathStrategy(name string) (PathStrategy, bool) {
+	for p, n := range pathStrategyName {
+		if n == name {
+			return p, true
+		}
+	}
+	return PathColumn, false
+}
+
+// JSONBCast returns the PostgreSQL type to which the text of a JSONB path,
+// as given by ->>, is cast for comparison with the value n: numeric for a
+// number, boolean for a boolean, and the type of the first member for a
+// list. Other values are compared with the text itself, and give "".
+func JSONBCast(n Node) string {
+	switch n := n.(type) {
+	case *NumberNode:
+		return "numeric"
+	case *BoolNode:
+		return "boolean"
+	case *ListNode:
+		if len(n.Nodes) > 0 {
+			return JSONBCast(n.Nodes[0])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package rql
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy constrains the queries of a caller, such as to the rows of their
+// tenant. Every query is combined with the policy's filters, so that its
+// results always satisfy them, and queries which refer to protected fields
+// are rejected.
+type Policy struct {
+	Filters   []*Tree  // conditions which every query must satisfy
+	Params    []string // identifiers in the filters which are parameters
+	Protected []string // fields which queries may not refer to
+}
+
+// Apply returns a tree requiring both the query and every filter of the
+// policy, as and(filter, ..., query). As RQL has no negation, no query can
+// widen its results beyond the filters.
+//
+// Identifiers in the filters which are named by the policy's Params are
+// replaced by their values in params, which may be strings, finite numbers,
+// booleans, nil, times or slices of them. A filter of eq(tenant_id,tenant)
+// with the parameter tenant set to 7 becomes eq(tenant_id,7). Every
+// parameter must be given a value, and params may not set any other, so that
+// a missing or misspelt parameter is not mistaken for a field.
+//
+// If the query refers to protected fields, Apply returns an ErrorList of
+// every such reference.
+func (p *Policy) Apply(query *Tree, params map[string]interface{}) (*Tree, error) {
+	if errs := p.Check(query); len(errs) > 0 {
+		return nil, ErrorList(errs)
+	}
+	declared := map[string]bool{}
+	for _, name := range p.Params {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("policy: parameter %s is not bound", name)
+		}
+		declared[name] = true
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, fmt.Errorf("policy: parameter %s is not declared", name)
+		}
+	}
+	conds := []string{}
+	for _, f := range p.Filters {
+		if empty(f) {
+			continue
+		}
+		s, err := bind(f.Root.Operator, params)
+		if err != nil {
+			return nil, fmt.Errorf("policy: %s", err)
+		}
+		conds = append(conds, s)
+	}
+	name := "policy"
+	if query != nil {
+		name = query.Name
+	}
+	if !empty(query) {
+		conds = append(conds, query.Root.Operator.String())
+	}
+	src := strings.Join(conds, ",")
+	if len(conds) > 1 {
+		src = "and(" + src + ")"
+	}
+	t, err := New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%v in policy %s", err, src)
+	}
+	return t, nil
+}
+
+// Check returns an error for every reference in the tree to a protected
+// field, or to a field nested within one.
+func (p *Policy) Check(t *Tree) []*Error {
+	c := &policyChecker{policy: p, tree: t}
+	if !empty(t) {
+		c.walk(t.Root.Operator)
+	}
+	return c.errs
+}
+
+// protected reports whether the identifier refers to a protected field.
+// Fields are compared without regard to case, as SQL identifiers are.
+func (p *Policy) protected(n *IdentifierNode) bool {
+	for _, f := range p.Protected {
+		if strings.EqualFold(n.Ident, f) {
+			return true
+		}
+		if len(n.Ident) > len(f) && strings.EqualFold(n.Ident[:len(f)+1], f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// policyChecker holds the state of a single Policy.Check
+type policyChecker struct {
+	policy *Policy
+	tree   *Tree
+	errs   []*Error
+}
+
+func (c *policyChecker) walk(n Node) {
+	switch n := n.(type) {
+	case *IdentifierNode:
+		if c.policy.protected(n) {
+			c.errs = append(c.errs, c.tree.newError(n.Pos, fmt.Sprintf("field %q is protected", n.Ident)))
+		}
+	case *FunctionNode:
+		c.walk(n.Args)
+	case *ListNode:
+		for _, node := range n.Nodes {
+			c.walk(node)
+		}
+	case *OperatorNode:
+		if (n.Operator == "any" || n.Operator == "all") && len(n.Operands.Nodes) > 0 {
+			// identifiers within the predicate refer to the array's elements
+			c.walk(n.Operands.Nodes[0])
+			return
+		}
+		c.walk(n.Operands)
+	}
+}
+
+// empty reports whether the tree has no operator
+func empty(t *Tree) bool {
+	return t == nil || t.Root == nil || t.Root.Operator == nil
+}
+
+// bind returns the RQL text of the node with parameters replaced by their
+// values
+func bind(n Node, params map[string]interface{}) (string, error) {
+	switch n := n.(type) {
+	case *IdentifierNode:
+		if v, ok := params[n.Ident]; ok {
+			return literal(n.Ident, v)
+		}
+	case *OperatorNode:
+		args, err := bind(n.Operands, params)
+		return n.Operator + args, err
+	case *FunctionNode:
+		args, err := bind(n.Args, params)
+		return n.Name + args, err
+	case *ListNode:
+		str := []string{}
+		for _, node := range n.Nodes {
+			s, err := bind(node, params)
+			if err != nil {
+				return "", err
+			}
+			str = append(str, s)
+		}
+		return "(" + strings.Join(str, ",") + ")", nil
+	}
+	return n.String(), nil
+}
+
+// literal returns the RQL literal for the value of a parameter
+func literal(name string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return strconv.Quote(v), nil
+	case time.Time:
+		return strconv.Quote(v.Format(time.RFC3339Nano)), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		// RQL has no literal for NaN or the infinities
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("parameter %s is not a finite number: %v", name, f)
+		}
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.String:
+		return strconv.Quote(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			return "", fmt.Errorf("parameter %s is an empty list", name)
+		}
+		str := []string{}
+		for i := 0; i < rv.Len(); i++ {
+			s, err := literal(name, rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			str = append(str, s)
+		}
+		return "(" + strings.Join(str, ",") + ")", nil
+	}
+	return "", fmt.Errorf("parameter %s has unsupported type %T", name, v)
+}
@@ -0,0 +1,103 @@
+package rql
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var policyTests = []struct {
+	name    string
+	filters []string
+	params  map[string]interface{}
+	input   string
+	result  string
+	errors  []string
+}{
+	{"tenant", []string{`eq(tenant_id,tenant)`}, map[string]interface{}{"tenant": 7},
+		`or(eq(status,"open"),gt(age,21))`, `and(eq(tenant_id,7),or(eq(status,"open"),gt(age,21)))`, nil},
+	{"empty query", []string{`eq(tenant_id,tenant)`}, map[string]interface{}{"tenant": "acme"},
+		``, `eq(tenant_id,"acme")`, nil},
+	{"no filters", nil, nil, `eq(id,12)`, `eq(id,12)`, nil},
+	{"several filters", []string{`eq(tenant_id,tenant)`, `in(region,regions)`, `ne(deleted_at,null)`},
+		map[string]interface{}{"tenant": uint(3), "regions": []string{"eu", "us"}},
+		`eq(id,12)`, `and(eq(tenant_id,3),in(region,("eu","us")),ne(deleted_at,null),eq(id,12))`, nil},
+	{"parameter values", []string{`and(eq(active,yes),gt(score,min),lt(created,now),eq(owner,nobody))`},
+		map[string]interface{}{"yes": true, "min": 1.5, "now": time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "nobody": nil},
+		``, `and(eq(active,true),gt(score,1.5),lt(created,"2024-05-01T00:00:00Z"),eq(owner,null))`, nil},
+	{"quoted parameter", []string{`eq(tenant_id,tenant)`}, map[string]interface{}{"tenant": `x"),or(eq(1,1`},
+		``, `eq(tenant_id,"x\"),or(eq(1,1")`, nil},
+	{"protected", []string{`eq(tenant_id,tenant)`}, map[string]interface{}{"tenant": 7},
+		`or(eq(tenant_id,8),eq(lower(tenant_id.name),"x"),any(tags,eq(tenant_id,8)))`, ``, []string{
+			`statement: protected:1: field "tenant_id" is protected`,
+			`statement: protected:1: field "tenant_id.name" is protected`,
+		}},
+	{"protected case", []string{`eq(tenant_id,tenant)`}, map[string]interface{}{"tenant": 7},
+		`or(eq(Tenant_ID,8),eq(TENANT_ID.name,"x"))`, ``, []string{
+			`statement: protected case:1: field "Tenant_ID" is protected`,
+			`statement: protected case:1: field "TENANT_ID.name" is protected`,
+		}},
+}
+
+func TestPolicyApply(t *testing.T) {
+	for _, test := range policyTests {
+		p := &Policy{Protected: []string{"tenant_id"}}
+		for name := range test.params {
+			p.Params = append(p.Params, name)
+		}
+		for _, f := range test.filters {
+			tree, err := New("filter").Parse(f)
+			if err != nil {
+				t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+			}
+			p.Filters = append(p.Filters, tree)
+		}
+		query, err := New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		tree, err := p.Apply(query, test.params)
+		if test.errors != nil {
+			errs, ok := err.(ErrorList)
+			if !ok || len(errs) != len(test.errors) {
+				t.Errorf("%s: expected %d errors, got %v", test.name, len(test.errors), err)
+				continue
+			}
+			for i, e := range errs {
+				if e.Error() != test.errors[i] {
+					t.Errorf("%s: error mismatch: expected\n  %s\ngot\n  %s", test.name, test.errors[i], e)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := tree.Root.String(); got != test.result {
+			t.Errorf("%s: expected\n  %s\ngot\n  %s", test.name, test.result, got)
+		}
+	}
+}
+
+func TestPolicyParameterError(t *testing.T) {
+	filter, err := New("filter").Parse(`eq(tenant_id,tenant)`)
+	if err != nil {
+		t.Fatalf("unexpected parse failure: %v", err)
+	}
+	p := &Policy{Filters: []*Tree{filter}, Params: []string{"tenant"}}
+	for _, v := range []interface{}{struct{}{}, []int{}, math.NaN(), math.Inf(1), float32(math.Inf(-1)), []float64{1, math.NaN()}} {
+		if _, err := p.Apply(nil, map[string]interface{}{"tenant": v}); err == nil {
+			t.Errorf("expected error for parameter %#v; got none", v)
+		}
+	}
+	for _, params := range []map[string]interface{}{
+		nil,
+		{"tennant": 7},
+		{"tenant": 7, "region": "eu"},
+	} {
+		if tree, err := p.Apply(nil, params); err == nil {
+			t.Errorf("expected error for parameters %v; got %s", params, tree.Root)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package rql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Printer formats parse trees as RQL text. Operators which fit within
+// MaxWidth are printed on one line; otherwise each operand is printed on
+// its own line, indented one level deeper than the operator.
+type Printer struct {
+	Indent       string // indentation for each nesting level
+	MaxWidth     int    // maximum width of a line, 0 for no limit
+	BreakLogical bool   // print each operand of and/or on its own line
+	Compact      bool   // omit the space after commas
+}
+
+// DefaultPrinter is the Printer used by Format
+var DefaultPrinter = &Printer{Indent: "  ", MaxWidth: 80}
+
+// Format parses the text, including its comments, and returns it
+// formatted by the DefaultPrinter.
+func Format(name, text string) (string, error) {
+	t := New(name)
+	t.Mode = ParseComments
+	if _, err := t.Parse(text); err != nil {
+		return "", err
+	}
+	return DefaultPrinter.Format(t), nil
+}
+
+// Format returns the tree formatted as a string
+func (p *Printer) Format(t *Tree) string {
+	b := new(bytes.Buffer)
+	p.Fprint(b, t)
+	return b.String()
+}
+
+// Fprint writes the formatted tree to w. Comments collected in
+// Tree.Comments are printed before the node which follows them, or at the
+// end of the line when they trailed an operand in the original text.
+func (p *Printer) Fprint(w io.Writer, t *Tree) error {
+	pr := &printer{Printer: p, text: t.text, buf: new(bytes.Buffer)}
+	pr.comments = append(pr.comments, t.Comments...)
+	sort.Slice(pr.comments, func(i, j int) bool { return pr.comments[i].Pos < pr.comments[j].Pos })
+	if t.Root != nil && t.Root.Operator != nil {
+		pr.leading(t.Root.Operator.Position(), 0)
+		pr.node(t.Root.Operator, 0)
+		pr.trailing(t.Root.Operator.Position(), Pos(len(t.text)))
+		pr.buf.WriteString("\n")
+	}
+	for _, c := range pr.comments {
+		pr.buf.WriteString(c.Text)
+		pr.buf.WriteString("\n")
+	}
+	_, err := w.Write(pr.buf.Bytes())
+	return err
+}
+
+// printer holds the state of a single Fprint
+type printer struct {
+	*Printer
+	text     string
+	buf      *bytes.Buffer
+	comments []*CommentNode // comments not yet printed
+}
+
+func (p *printer) indent(depth int) string {
+	return strings.Repeat(p.Indent, depth)
+}
+
+func (p *printer) comma() string {
+	if p.Compact {
+		return ","
+	}
+	return ", "
+}
+
+// column returns the width of the current line
+func (p *printer) column() int {
+	b := p.buf.Bytes()
+	return len(b) - bytes.LastIndexByte(b, '\n') - 1
+}
+
+// leading prints, each on its own line, the comments which precede pos
+func (p *printer) leading(pos Pos, depth int) {
+	for len(p.comments) > 0 && p.comments[0].Pos < pos {
+		p.buf.WriteString(p.comments[0].Text)
+		p.buf.WriteString("\n" + p.indent(depth))
+		p.comments = p.comments[1:]
+	}
+}
+
+// trailing prints the comments which follow the node at pos on the same line
+// of the original text, before the next node at end.
+func (p *printer) trailing(pos, end Pos) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if c.Pos < pos || c.Pos >= end || int(c.Pos) > len(p.text) || strings.Contains(p.text[pos:c.Pos], "\n") {
+			return
+		}
+		p.buf.WriteString(" " + c.Text)
+		p.comments = p.comments[1:]
+		if strings.HasPrefix(c.Text, "#") {
+			return
+		}
+	}
+}
+
+// commented reports whether any pending comment lies within the list
+func (p *printer) commented(l *ListNode) bool {
+	for _, c := range p.comments {
+		if c.Pos > l.Pos && c.Pos < l.end {
+			return true
+		}
+	}
+	return false
+}
+
+// node prints n, breaking its operands onto separate lines if required
+func (p *printer) node(n Node, depth int) {
+	op, ok := n.(*OperatorNode)
+	if !ok || !p.broken(op) {
+		p.buf.WriteString(p.flat(n))
+		return
+	}
+	p.buf.WriteString(op.Operator + "(")
+	nodes := op.Operands.Nodes
+	p.trailing(op.Operands.Pos, nodes[0].Position())
+	for i, operand := range nodes {
+		p.buf.WriteString("\n" + p.indent(depth+1))
+		p.leading(operand.Position(), depth+1)
+		p.node(operand, depth+1)
+		end := op.Operands.end
+		if i < len(nodes)-1 {
+			p.buf.WriteString(",")
+			end = nodes[i+1].Position()
+		}
+		p.trailing(operand.Position(), end)
+	}
+	for len(p.comments) > 0 && p.comments[0].Pos < op.Operands.end {
+		p.buf.WriteString("\n" + p.indent(depth+1) + p.comments[0].Text)
+		p.comments = p.comments[1:]
+	}
+	p.buf.WriteString("\n" + p.indent(depth) + ")")
+}
+
+// broken reports whether the operands of op must be printed on separate lines
+func (p *printer) broken(op *OperatorNode) bool {
+	if len(op.Operands.Nodes) == 0 {
+		return false
+	}
+	if p.commented(op.Operands) {
+		return true
+	}
+	if p.BreakLogical && (op.Operator == "and" || op.Operator == "or") && len(op.Operands.Nodes) > 1 {
+		return true
+	}
+	return p.MaxWidth > 0 && p.column()+len(p.flat(op))+1 > p.MaxWidth
+}
+
+// flat returns n printed on a single line
+func (p *printer) flat(n Node) string {
+	switch n := n.(type) {
+	case *OperatorNode:
+		return n.Operator + p.flat(n.Operands)
+	case *FunctionNode:
+		return n.Name + p.flat(n.Args)
+	case *ListNode:
+		str := []string{}
+		for _, v := range n.Nodes {
+			str = append(str, p.flat(v))
+		}
+		return "(" + strings.Join(str, p.comma()) + ")"
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(n)
+}
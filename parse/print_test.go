@@ -0,0 +1,52 @@
+package rql
+
+import "testing"
+
+var formatTests = []struct {
+	name    string
+	printer *Printer
+	input   string
+	result  string
+}{
+	{"empty", DefaultPrinter, "", ""},
+	{"spacing", DefaultPrinter, "and( eq(id,12) ,gt( age,21 ))", "and(eq(id, 12), gt(age, 21))\n"},
+	{"compact", &Printer{Compact: true}, "and( eq(id,12) , gt( age,21 ))", "and(eq(id,12),gt(age,21))\n"},
+	{"functions and lists", DefaultPrinter, `and(in(id,(1,2,3)),eq(lower(email),"x@y.com"))`, "and(in(id, (1, 2, 3)), eq(lower(email), \"x@y.com\"))\n"},
+	{"break logical", &Printer{Indent: "\t", BreakLogical: true}, "and(eq(id,12),or(lt(age,21),gt(height,156.2)))",
+		"and(\n\teq(id, 12),\n\tor(\n\t\tlt(age, 21),\n\t\tgt(height, 156.2)\n\t)\n)\n"},
+	{"max width", &Printer{Indent: "  ", MaxWidth: 40}, "and(eq(id,12),or(lt(age,21),gt(height,156.2)))",
+		"and(\n  eq(id, 12),\n  or(lt(age, 21), gt(height, 156.2))\n)\n"},
+	{"comments", DefaultPrinter, "# open tickets\nand( # first\n  eq(status,\"open\"),\n  /* adults */ ge(age,21) # inclusive\n  # done\n)\n# end",
+		"# open tickets\nand( # first\n  eq(status, \"open\"),\n  /* adults */\n  ge(age, 21) # inclusive\n  # done\n)\n# end\n"},
+	{"only comments", DefaultPrinter, "# nothing\n", "# nothing\n"},
+	{"comment between operands", DefaultPrinter, "and(eq(a,1) /* x */, eq(b,2))", "and(\n  eq(a, 1), /* x */\n  eq(b, 2)\n)\n"},
+	{"comment in list", DefaultPrinter, "in(id,(1, # one\n2))", "in(\n  id,\n  (1, 2) # one\n)\n"},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range formatTests {
+		tree := New(test.name)
+		tree.Mode = ParseComments
+		if _, err := tree.Parse(test.input); err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		got := test.printer.Format(tree)
+		if got != test.result {
+			t.Errorf("%s: format mismatch\n\texpected:\n%s\n\tgot:\n%s", test.name, test.result, got)
+		}
+		// formatting is idempotent
+		again, err := Format(test.name, got)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure of formatted text: %v", test.name, err)
+		}
+		if test.printer == DefaultPrinter && again != got {
+			t.Errorf("%s: format not idempotent\n\tfirst:\n%s\n\tsecond:\n%s", test.name, got, again)
+		}
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	if _, err := Format("error", "eq(id"); err == nil {
+		t.Errorf("expected error; got none")
+	}
+}
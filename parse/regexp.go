@@ -0,0 +1,49 @@
+package rql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchFlags are the flags accepted by the match operator:
+// i for case-insensitive and m for multi-line matching.
+const MatchFlags = "im"
+
+// MatchPattern returns the pattern and flags operands of a
+// match(identifier, pattern[, flags]) operator.
+func MatchPattern(op *OperatorNode) (pattern, flags string, err error) {
+	nodes := op.Operands.Nodes
+	if len(nodes) != 2 && len(nodes) != 3 {
+		return "", "", fmt.Errorf("match expects 2 or 3 operands, got %d", len(nodes))
+	}
+	p, ok := nodes[1].(*StringNode)
+	if !ok {
+		return "", "", fmt.Errorf("match pattern must be a string, got %s", nodes[1])
+	}
+	if len(nodes) == 3 {
+		f, ok := nodes[2].(*StringNode)
+		if !ok {
+			return "", "", fmt.Errorf("match flags must be a string, got %s", nodes[2])
+		}
+		for _, r := range f.Text {
+			if !strings.ContainsRune(MatchFlags, r) {
+				return "", "", fmt.Errorf("unknown match flag %q", r)
+			}
+		}
+		flags = f.Text
+	}
+	return p.Text, flags, nil
+}
+
+// CompileMatch compiles the pattern of a match operator, applying its flags.
+func CompileMatch(op *OperatorNode) (*regexp.Regexp, error) {
+	pattern, flags, err := MatchPattern(op)
+	if err != nil {
+		return nil, err
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,198 @@
+package rql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Schema describes the fields which identifiers may refer to, and the types
+// of their values.
+type Schema struct {
+	Fields map[string]ValueType
+	Roles  map[string]*Role // permissions of each caller role, for ValidateRole
+}
+
+// Role describes the fields a caller may filter on and the operators they
+// may use.
+type Role struct {
+	// Fields maps the fields the role may refer to, and the fields nested
+	// within them, to the operators which may be applied to them. An empty
+	// list allows every operator.
+	Fields map[string][]string `json:"fields"`
+
+	// Operators lists the operators the role may use, including and and or.
+	// An empty list allows every operator.
+	Operators []string `json:"operators,omitempty"`
+}
+
+// field returns the operators allowed on the field an identifier refers to,
+// from the entry for the identifier or for the nearest field containing it
+func (r *Role) field(ident string) ([]string, bool) {
+	path := strings.Split(ident, ".")
+	for i := len(path); i > 0; i-- {
+		if ops, ok := r.Fields[strings.Join(path[:i], ".")]; ok {
+			return ops, true
+		}
+	}
+	return nil, false
+}
+
+// allows reports whether name is in the list, or the list is empty
+func allows(list []string, name string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadSchema reads a schema from JSON mapping field names to type names,
+// such as {"id": "number", "email": "string", "created": "time"}.
+func LoadSchema(r io.Reader) (*Schema, error) {
+	s := &Schema{}
+	if err := json.NewDecoder(r).Decode(&s.Fields); err != nil {
+		return nil, fmt.Errorf("schema: %s", err)
+	}
+	return s, nil
+}
+
+// Field returns the type of the field an identifier refers to. Dotted
+// identifiers which are not fields themselves refer to nested values of
+// their first segment, whose type is unknown.
+func (s *Schema) Field(n *IdentifierNode) (ValueType, bool) {
+	if typ, ok := s.Fields[n.Ident]; ok {
+		return typ, true
+	}
+	if n.IsPath() {
+		if _, ok := s.Fields[n.Path()[0]]; ok {
+			return TypeAny, true
+		}
+	}
+	return TypeAny, false
+}
+
+// Validate checks that every identifier in the tree is a field of the
+// schema, and that comparisons match the types of their fields. It returns
+// every problem found.
+func (s *Schema) Validate(t *Tree) []*Error {
+	v := &validator{schema: s, tree: t}
+	if t.Root != nil && t.Root.Operator != nil {
+		v.walk(t.Root.Operator, "")
+	}
+	return v.errs
+}
+
+// ValidateRole checks the tree as Validate does, and also that the role
+// permits every field and operator it uses, and each operator applied to a
+// field. Within the predicate of any or all, fields are those nested within
+// the array, with _ referring to the array itself. It returns every problem
+// found.
+func (s *Schema) ValidateRole(t *Tree, role string) []*Error {
+	v := &validator{schema: s, tree: t, roleName: role, role: s.Roles[role]}
+	if v.role == nil {
+		v.errorf(0, "unknown role %q", role)
+		return v.errs
+	}
+	if t.Root != nil && t.Root.Operator != nil {
+		v.walk(t.Root.Operator, "")
+	}
+	return v.errs
+}
+
+// validator holds the state of a single Schema.Validate or ValidateRole
+type validator struct {
+	schema   *Schema
+	tree     *Tree
+	errs     []*Error
+	roleName string
+	role     *Role    // nil unless validating a role
+	scope    []string // arrays of the any and all predicates being walked
+}
+
+func (v *validator) errorf(pos Pos, format string, args ...interface{}) {
+	v.errs = append(v.errs, v.tree.newError(pos, fmt.Sprintf(format, args...)))
+}
+
+// typeOf returns the type of the operand, using the schema for identifiers
+func (v *validator) typeOf(n Node) ValueType {
+	if ident, ok := n.(*IdentifierNode); ok {
+		typ, _ := v.schema.Field(ident)
+		return typ
+	}
+	typ, _ := TypeOf(n)
+	return typ
+}
+
+// qualify returns the field an identifier refers to, which within a
+// predicate is nested within the array
+func (v *validator) qualify(n *IdentifierNode) string {
+	if len(v.scope) == 0 {
+		return n.Ident
+	}
+	array := v.scope[len(v.scope)-1]
+	if n.Ident == "_" {
+		return array
+	}
+	return array + "." + n.Ident
+}
+
+// walk checks the node, which is an operand of the operator op
+func (v *validator) walk(n Node, op string) {
+	switch n := n.(type) {
+	case *IdentifierNode:
+		if len(v.scope) == 0 {
+			if _, ok := v.schema.Field(n); !ok {
+				v.errorf(n.Pos, "unknown field %q", n.Ident)
+			}
+		}
+		if v.role != nil {
+			field := v.qualify(n)
+			if ops, ok := v.role.field(field); !ok {
+				v.errorf(n.Pos, "field %q is not permitted for role %s", field, v.roleName)
+			} else if !allows(ops, op) {
+				v.errorf(n.Pos, "%s is not permitted on field %q for role %s", op, field, v.roleName)
+			}
+		}
+	case *FunctionNode:
+		v.walk(n.Args, op)
+	case *ListNode:
+		for _, node := range n.Nodes {
+			v.walk(node, op)
+		}
+	case *OperatorNode:
+		if v.role != nil && !allows(v.role.Operators, n.Operator) {
+			v.errorf(n.Pos, "operator %s is not permitted for role %s", n.Operator, v.roleName)
+		}
+		switch n.Operator {
+		case "any", "all":
+			// identifiers within the predicate refer to the array's elements
+			if len(n.Operands.Nodes) > 0 {
+				v.walk(n.Operands.Nodes[0], n.Operator)
+			}
+			if v.role == nil || len(n.Operands.Nodes) != 2 {
+				return
+			}
+			if array, ok := n.Operands.Nodes[0].(*IdentifierNode); ok {
+				v.scope = append(v.scope, v.qualify(array))
+				v.walk(n.Operands.Nodes[1], n.Operator)
+				v.scope = v.scope[:len(v.scope)-1]
+			}
+			return
+		case "eq", "ne", "lt", "gt", "le", "ge":
+			if len(n.Operands.Nodes) == 2 && len(v.scope) == 0 {
+				left := v.typeOf(n.Operands.Nodes[0])
+				right := v.typeOf(n.Operands.Nodes[1])
+				if !left.accepts(right) && !right.accepts(left) {
+					v.errorf(n.Pos, "%s cannot compare %s with %s", n.Operator, left, right)
+				}
+			}
+		}
+		v.walk(n.Operands, n.Operator)
+	}
+}
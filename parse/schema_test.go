@@ -0,0 +1,117 @@
+package rql
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSchema = `{"id": "number", "email": "string", "created": "time", "tags": "any", "profile": "any"}`
+
+var schemaTests = []struct {
+	name   string
+	input  string
+	errors []string
+}{
+	{"valid", `and(eq(id,12),eq(lower(email),"x@y.com"),gt(created,"2024-01-01"))`, nil},
+	{"nested field", `eq(profile.address.city,"Paris")`, nil},
+	{"array predicate", `any(tags,eq(_,"a"))`, nil},
+	{"unknown field", `and(eq(id,12),eq(name,"x"))`, []string{`statement: unknown field:1: unknown field "name"`}},
+	{"type mismatch", `or(eq(id,"12"),eq(email,12),eq(nope,1))`, []string{
+		`statement: type mismatch:1: eq cannot compare number with string`,
+		`statement: type mismatch:1: eq cannot compare string with number`,
+		`statement: type mismatch:1: unknown field "nope"`,
+	}},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := LoadSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("unexpected schema failure: %v", err)
+	}
+	for _, test := range schemaTests {
+		tree, err := New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		errs := schema.Validate(tree)
+		if len(errs) != len(test.errors) {
+			t.Errorf("%s: expected %d errors, got %d: %v", test.name, len(test.errors), len(errs), errs)
+			continue
+		}
+		for i, e := range errs {
+			if e.Error() != test.errors[i] {
+				t.Errorf("%s: error mismatch: expected\n  %s\ngot\n  %s", test.name, test.errors[i], e)
+			}
+		}
+	}
+}
+
+func TestLoadSchemaError(t *testing.T) {
+	if _, err := LoadSchema(strings.NewReader(`{"id": "integer"}`)); err == nil {
+		t.Errorf("expected error for unknown type; got none")
+	}
+}
+
+var testRoles = map[string]*Role{
+	"support": {
+		Fields:    map[string][]string{"id": nil, "email": {"eq"}, "profile.address": nil, "tags": {"any", "eq"}},
+		Operators: []string{"and", "or", "eq", "in", "any"},
+	},
+	"admin": {Fields: map[string][]string{"id": nil, "email": nil, "created": nil, "tags": nil, "profile": nil}},
+}
+
+var roleTests = []struct {
+	name   string
+	role   string
+	input  string
+	errors []string
+}{
+	{"permitted", "support", `and(in(id,(1,2)),eq(lower(email),"x@y.com"),eq(profile.address.city,"Paris"),any(tags,eq(_,"a")))`, nil},
+	{"unrestricted", "admin", `and(gt(created,"2024-01-01"),match(email,"@example"),all(profile.orders,gt(total,1)))`, nil},
+	{"field", "support", `or(eq(created,"2024-01-01"),eq(profile.name,"x"))`, []string{
+		`statement: field:1: field "created" is not permitted for role support`,
+		`statement: field:1: field "profile.name" is not permitted for role support`,
+	}},
+	{"operator", "support", `and(gt(id,12),match(email,"@example"))`, []string{
+		`statement: operator:1: operator gt is not permitted for role support`,
+		`statement: operator:1: operator match is not permitted for role support`,
+		`statement: operator:1: match is not permitted on field "email" for role support`,
+	}},
+	{"field operator", "support", `in(email,("a","b"))`, []string{
+		`statement: field operator:1: in is not permitted on field "email" for role support`,
+	}},
+	{"predicate", "support", `any(tags,in(_,("a","b")))`, []string{
+		`statement: predicate:1: in is not permitted on field "tags" for role support`,
+	}},
+	{"nested predicate", "support", `any(profile.address,eq(city,"Paris"))`, nil},
+	{"schema", "admin", `and(eq(id,"12"),eq(name,"x"))`, []string{
+		`statement: schema:1: eq cannot compare number with string`,
+		`statement: schema:1: unknown field "name"`,
+		`statement: schema:1: field "name" is not permitted for role admin`,
+	}},
+	{"unknown role", "guest", `eq(id,12)`, []string{`statement: unknown role:1: unknown role "guest"`}},
+}
+
+func TestSchemaValidateRole(t *testing.T) {
+	schema, err := LoadSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("unexpected schema failure: %v", err)
+	}
+	schema.Roles = testRoles
+	for _, test := range roleTests {
+		tree, err := New(test.name).Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse failure: %v", test.name, err)
+		}
+		errs := schema.ValidateRole(tree, test.role)
+		if len(errs) != len(test.errors) {
+			t.Errorf("%s: expected %d errors, got %d: %v", test.name, len(test.errors), len(errs), errs)
+			continue
+		}
+		for i, e := range errs {
+			if e.Error() != test.errors[i] {
+				t.Errorf("%s: error mismatch: expected\n  %s\ngot\n  %s", test.name, test.errors[i], e)
+			}
+		}
+	}
+}